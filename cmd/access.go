@@ -1,13 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
 )
 
 var accessCmd = &cobra.Command{
@@ -20,32 +20,58 @@ var accessListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all users with access",
 	Run: func(cmd *cobra.Command, args []string) {
-		if keyFile == "" {
-			home, _ := os.UserHomeDir()
-			keyFile = filepath.Join(home, ".memevault", "keys", "memevault.key")
-		}
-
-		secrets, err := loadSecrets(vaultFile, keyFile)
+		v, err := openVault()
 		if err != nil {
 			fmt.Printf("Error loading secrets: %v\n", err)
 			return
 		}
 
-		recipients := getRecipients(secrets)
+		recipients := v.Recipients()
 		if len(recipients) == 0 {
 			fmt.Println("No recipients found (implicit single-user mode or legacy vault).")
 			return
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		fmt.Fprintln(w, "NAME\tPUBLIC KEY")
+		fmt.Fprintln(w, "NAME\tTYPE\tPUBLIC KEY\tSIGNING KEY\tSIGNER")
 		for _, r := range recipients {
-			fmt.Fprintf(w, "%s\t%s\n", r.Name, r.PublicKey)
+			signingKey := r.SigningKey
+			if signingKey == "" {
+				signingKey = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.Type(), r.PublicKey, signingKey, v.SignerTrust(r))
 		}
 		w.Flush()
 	},
 }
 
+var accessTrustCmd = &cobra.Command{
+	Use:   "trust [NAME|KEY]",
+	Short: "Trust the signing key of a recipient",
+	Long: `Pin the signing key recorded for a recipient, so vaults they sign are
+accepted without a warning. Signing keys are pinned the first time you open a
+vault and when a trusted signer grants access; run this after a teammate
+rotates their key or when memevault reports an untrusted or changed signer,
+once you've compared the signing key in 'access list' with theirs.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// The signer being trusted may be exactly what --verify rejects
+		verifyMode = string(vault.VerifyOff)
+		v, err := openVault()
+		if err != nil {
+			fmt.Printf("Error loading secrets: %v\n", err)
+			return
+		}
+
+		r, err := v.TrustSigner(args[0])
+		if err != nil {
+			fmt.Printf("Error trusting signer: %v\n", err)
+			return
+		}
+		fmt.Printf("Trusting signatures by %s (%s) with signing key %s.\n", r.Name, r.PublicKey, r.SigningKey)
+	},
+}
+
 var accessRemoveCmd = &cobra.Command{
 	Use:   "remove [NAME|KEY]",
 	Short: "Revoke access for a user",
@@ -53,52 +79,28 @@ var accessRemoveCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		target := args[0]
 
-		if keyFile == "" {
-			home, _ := os.UserHomeDir()
-			keyFile = filepath.Join(home, ".memevault", "keys", "memevault.key")
+		lock, err := lockVault()
+		if err != nil {
+			fmt.Printf("Error locking vault: %v\n", err)
+			return
 		}
+		defer lock.Unlock()
 
-		secrets, err := loadSecrets(vaultFile, keyFile)
+		v, err := openVault()
 		if err != nil {
 			fmt.Printf("Error loading secrets: %v\n", err)
 			return
 		}
 
-		// Safeguard: Do not remove self
-		// Need current public key
-		currentKey, err := os.ReadFile(keyFile)
-		if err == nil {
-			// Extract public key
-			lines := strings.Split(string(currentKey), "\n")
-			for _, line := range lines {
-				if strings.HasPrefix(line, "# Public Key: ") {
-					myPub := strings.TrimSpace(strings.TrimPrefix(line, "# Public Key: "))
-					if target == myPub {
-						fmt.Println("Error: You cannot remove yourself!")
-						return
-					}
-					// Also check if target name maps to my key
-					recipients := getRecipients(secrets)
-					for _, r := range recipients {
-						if r.Name == target && r.PublicKey == myPub {
-							fmt.Println("Error: You cannot remove yourself!")
-							return
-						}
-					}
-				}
-			}
+		// Safeguard: Revoke refuses to remove the key we opened the vault with
+		removed, err := v.Revoke(target)
+		if errors.Is(err, vault.ErrRevokeSelf) {
+			fmt.Println("Error: You cannot remove yourself!")
+			return
 		}
-
-		recipients := getRecipients(secrets)
-		var newRecipients []Recipient
-		removed := false
-
-		for _, r := range recipients {
-			if r.Name == target || r.PublicKey == target {
-				removed = true
-				continue
-			}
-			newRecipients = append(newRecipients, r)
+		if err != nil {
+			fmt.Printf("Error removing user: %v\n", err)
+			return
 		}
 
 		if !removed {
@@ -106,7 +108,7 @@ var accessRemoveCmd = &cobra.Command{
 			return
 		}
 
-		if err := saveSecrets(vaultFile, secrets, newRecipients); err != nil {
+		if err := saveVault(v); err != nil {
 			fmt.Printf("Error removing user: %v\n", err)
 			return
 		}
@@ -119,6 +121,7 @@ func init() {
 	rootCmd.AddCommand(accessCmd)
 	accessCmd.AddCommand(accessListCmd)
 	accessCmd.AddCommand(accessRemoveCmd)
+	accessCmd.AddCommand(accessTrustCmd)
 	// 'add' is handled by grant -> maybe we alias it later or move grant here?
 	// For now keeping grant as top-level command but access add could be an alias.
 }
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
+)
+
+var envParent string
+var clearParent bool
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage environments in the vault",
+	Long: `A vault can hold several environments (e.g. dev, staging, prod), each with
+its own secrets and recipients. Select one with --env or MEMEVAULT_ENV.`,
+}
+
+var envListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the environments in the vault",
+	Run: func(cmd *cobra.Command, args []string) {
+		opts, err := vaultOptions()
+		if err != nil {
+			fmt.Printf("Error loading vault: %v\n", err)
+			return
+		}
+
+		envs, err := vault.ListEnvs(vaultFile, opts)
+		if err != nil {
+			fmt.Printf("Error loading vault: %v\n", err)
+			return
+		}
+
+		current := opts.Env
+		if current == "" {
+			current = vault.DefaultEnv
+		}
+		for _, env := range envs {
+			if env == current {
+				fmt.Printf("* %s\n", env)
+			} else {
+				fmt.Printf("  %s\n", env)
+			}
+		}
+	},
+}
+
+var envCreateCmd = &cobra.Command{
+	Use:   "create [NAME]",
+	Short: "Create an environment",
+	Long: `Creates an empty environment. It starts with the recipients of the current
+environment (--env); use grant and access remove with --env NAME to change them.
+With --parent, the new environment inherits the secrets it doesn't set itself.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		lock, err := lockVault()
+		if err != nil {
+			fmt.Printf("Error locking vault: %v\n", err)
+			return
+		}
+		defer lock.Unlock()
+
+		v, err := openVault()
+		if err != nil {
+			fmt.Printf("Error loading secrets: %v\n", err)
+			return
+		}
+
+		from := v.Env()
+		if err := v.CreateEnv(name); err != nil {
+			fmt.Printf("Error creating environment: %v\n", err)
+			return
+		}
+		if err := v.SetParent(envParent); err != nil {
+			fmt.Printf("Error creating environment: %v\n", err)
+			return
+		}
+
+		if err := saveVault(v); err != nil {
+			fmt.Printf("Error saving vault: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Created environment '%s' with the %d recipient(s) of '%s'.\n", name, len(v.Recipients()), from)
+	},
+}
+
+var envParentCmd = &cobra.Command{
+	Use:   "parent [PARENT]",
+	Short: "Show or set the environment the current one inherits from",
+	Long: `Without arguments, shows the parent of the current environment (--env).
+With PARENT, the current environment inherits every secret of PARENT (and its
+ancestors) that it doesn't set itself. Use --clear to stop inheriting.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 && !clearParent {
+			v, err := openVault()
+			if err != nil {
+				fmt.Printf("Error loading secrets: %v\n", err)
+				return
+			}
+			if v.Parent() == "" {
+				fmt.Printf("'%s' does not inherit from another environment.\n", v.Env())
+				return
+			}
+			fmt.Println(v.Parent())
+			return
+		}
+
+		lock, err := lockVault()
+		if err != nil {
+			fmt.Printf("Error locking vault: %v\n", err)
+			return
+		}
+		defer lock.Unlock()
+
+		v, err := openVault()
+		if err != nil {
+			fmt.Printf("Error loading secrets: %v\n", err)
+			return
+		}
+
+		parent := ""
+		if len(args) > 0 && !clearParent {
+			parent = args[0]
+		}
+		if err := v.SetParent(parent); err != nil {
+			fmt.Printf("Error setting parent: %v\n", err)
+			return
+		}
+
+		if err := saveVault(v); err != nil {
+			fmt.Printf("Error saving vault: %v\n", err)
+			return
+		}
+
+		if parent == "" {
+			fmt.Printf("'%s' no longer inherits from another environment.\n", v.Env())
+		} else {
+			fmt.Printf("'%s' now inherits from '%s'.\n", v.Env(), parent)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.AddCommand(envListCmd)
+	envCmd.AddCommand(envCreateCmd)
+	envCmd.AddCommand(envParentCmd)
+	envCreateCmd.Flags().StringVar(&envParent, "parent", "", "Environment to inherit secrets from")
+	envParentCmd.Flags().BoolVar(&clearParent, "clear", false, "Stop inheriting from the parent environment")
+}
@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/thoughtlesslabs/memevault/pkg/dotenv"
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
+)
+
+var exportFormat string
+var exportOnly []string
+var exportPrefix string
+var exportName string
+var exportNamespace string
+
+// k8sName matches Kubernetes object names (DNS subdomains) and k8sNamespace
+// namespace names (DNS labels).
+var k8sName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+var k8sNamespace = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// exportFormats renders secrets for each --format. Keys are written
+// unquoted, so the export command drops those that aren't valid identifiers
+// (see vault.ValidKey) first; only values need quoting.
+var exportFormats = map[string]func(vault.SecretsMap) ([]byte, error){
+	"dotenv": func(secrets vault.SecretsMap) ([]byte, error) {
+		var b bytes.Buffer
+		for _, k := range secrets.Keys() {
+			fmt.Fprintf(&b, "%s=%s\n", k, dotenv.Quote(secrets[k]))
+		}
+		return b.Bytes(), nil
+	},
+	"json": func(secrets vault.SecretsMap) ([]byte, error) {
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(map[string]string(secrets))
+		return b.Bytes(), err
+	},
+	"yaml": func(secrets vault.SecretsMap) ([]byte, error) {
+		var b bytes.Buffer
+		for _, k := range secrets.Keys() {
+			fmt.Fprintf(&b, "%s: %s\n", yamlQuote(k), yamlQuote(secrets[k]))
+		}
+		return b.Bytes(), nil
+	},
+	"sh": func(secrets vault.SecretsMap) ([]byte, error) {
+		var b bytes.Buffer
+		for _, k := range secrets.Keys() {
+			fmt.Fprintf(&b, "export %s='%s'\n", k, strings.ReplaceAll(secrets[k], `'`, `'\''`))
+		}
+		return b.Bytes(), nil
+	},
+	"fish": func(secrets vault.SecretsMap) ([]byte, error) {
+		r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+		var b bytes.Buffer
+		for _, k := range secrets.Keys() {
+			fmt.Fprintf(&b, "set -gx %s '%s'\n", k, r.Replace(secrets[k]))
+		}
+		return b.Bytes(), nil
+	},
+	"powershell": func(secrets vault.SecretsMap) ([]byte, error) {
+		// PowerShell also ends single-quoted strings at typographic quotes
+		r := strings.NewReplacer("'", "''", "‘", "‘‘", "’", "’’", "‚", "‚‚", "‛", "‛‛")
+		var b bytes.Buffer
+		for _, k := range secrets.Keys() {
+			fmt.Fprintf(&b, "$env:%s = '%s'\n", k, r.Replace(secrets[k]))
+		}
+		return b.Bytes(), nil
+	},
+	"k8s-secret": func(secrets vault.SecretsMap) ([]byte, error) {
+		if exportName == "" {
+			return nil, fmt.Errorf("--name is required for k8s-secret")
+		}
+		if len(exportName) > 253 || !k8sName.MatchString(exportName) {
+			return nil, fmt.Errorf("invalid --name '%s': use lowercase letters, digits, '-' and '.'", exportName)
+		}
+		if exportNamespace != "" && (len(exportNamespace) > 63 || !k8sNamespace.MatchString(exportNamespace)) {
+			return nil, fmt.Errorf("invalid --namespace '%s': use lowercase letters, digits and '-'", exportNamespace)
+		}
+
+		var b bytes.Buffer
+		b.WriteString("apiVersion: v1\nkind: Secret\nmetadata:\n")
+		fmt.Fprintf(&b, "  name: %s\n", exportName)
+		if exportNamespace != "" {
+			fmt.Fprintf(&b, "  namespace: %s\n", exportNamespace)
+		}
+		b.WriteString("type: Opaque\n")
+		if len(secrets) == 0 {
+			b.WriteString("data: {}\n")
+			return b.Bytes(), nil
+		}
+		b.WriteString("data:\n")
+		for _, k := range secrets.Keys() {
+			fmt.Fprintf(&b, "  %s: %s\n", yamlQuote(k), base64.StdEncoding.EncodeToString([]byte(secrets[k])))
+		}
+		return b.Bytes(), nil
+	},
+	"docker-env": func(secrets vault.SecretsMap) ([]byte, error) {
+		// docker --env-file takes everything after the = literally, one
+		// variable per line, so values can't be quoted or span lines
+		var b bytes.Buffer
+		for _, k := range secrets.Keys() {
+			val := secrets[k]
+			if strings.ContainsAny(val, "\n\r\x00") {
+				return nil, fmt.Errorf("%s: docker env files can't hold values with newlines or NUL bytes", k)
+			}
+			if !utf8.ValidString(val) {
+				return nil, fmt.Errorf("%s: docker env files must be valid UTF-8", k)
+			}
+			fmt.Fprintf(&b, "%s=%s\n", k, val)
+		}
+		return b.Bytes(), nil
+	},
+}
+
+// selectSecrets narrows secrets down to the --only keys and the keys starting
+// with --prefix. Every --only key must exist.
+func selectSecrets(secrets vault.SecretsMap) (vault.SecretsMap, error) {
+	selected := vault.SecretsMap{}
+	if len(exportOnly) > 0 {
+		for _, k := range exportOnly {
+			val, ok := secrets[k]
+			if !ok {
+				return nil, fmt.Errorf("secret '%s' not found", k)
+			}
+			selected[k] = val
+		}
+	} else {
+		for _, k := range secrets.Keys() {
+			selected[k] = secrets[k]
+		}
+	}
+
+	for k := range selected {
+		if !strings.HasPrefix(k, exportPrefix) {
+			delete(selected, k)
+		}
+	}
+	return selected, nil
+}
+
+// yamlQuote returns s as a YAML double-quoted scalar, escaping everything
+// YAML doesn't allow unescaped there.
+func yamlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f || (r >= 0x80 && r <= 0x9f) || r == 0xfeff:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// exportFormatNames returns the supported --format values, sorted.
+func exportFormatNames() []string {
+	names := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print all secrets in a format other tools understand",
+	Long: `Prints the secrets (inherited and expanded, like run) quoted correctly for
+the chosen --format:
+
+  dotenv      KEY="value" lines for .env files
+  json        a JSON object
+  yaml        a YAML mapping
+  sh          export statements, e.g. eval "$(memevault export --format sh)"
+  fish        set -gx statements, e.g. memevault export --format fish | source
+  powershell  $env: assignments, e.g. memevault export --format powershell | iex
+  k8s-secret  a Kubernetes v1 Secret manifest; needs --name, takes --namespace
+  docker-env  a docker --env-file file (values can't span lines)
+
+--only and --prefix narrow down which secrets are exported.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Errors go to stderr so they never end up in an eval'd script
+		format, ok := exportFormats[exportFormat]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: unknown format '%s' (use %s)\n", exportFormat, strings.Join(exportFormatNames(), ", "))
+			os.Exit(1)
+		}
+
+		v, err := openVault()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading secrets: %v\n", err)
+			os.Exit(1)
+		}
+		secrets, err := v.Resolved()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading secrets: %v\n", err)
+			os.Exit(1)
+		}
+		secrets, err = selectSecrets(secrets)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		// Vault files written by other tools can hold any key, and a key
+		// like 'X=1;touch /tmp/pwned;Y' would run commands when eval'd
+		for _, k := range secrets.Keys() {
+			if !vault.ValidKey(k) {
+				fmt.Fprintf(os.Stderr, "Warning: Skipping invalid key '%s' found in vault.\n", k)
+				delete(secrets, k)
+			}
+		}
+
+		// Expand only the templates being exported. Keys asked for with
+		// --only must expand; others are skipped with a warning if they can't
+		if keys := secrets.Keys(); len(keys) > 0 {
+			var expanded vault.SecretsMap
+			if len(exportOnly) > 0 {
+				expanded, err = v.Expanded(keys...)
+			} else {
+				expanded, err = expandSecrets(v, keys...)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading secrets: %v\n", err)
+				os.Exit(1)
+			}
+			for _, k := range keys {
+				if val, ok := expanded[k]; ok {
+					secrets[k] = val
+				} else {
+					delete(secrets, k)
+				}
+			}
+		}
+
+		// Only base64 encoded formats can carry binary values
+		if exportFormat != "k8s-secret" {
+			for _, k := range secrets.Keys() {
+				if vault.TypeOf(secrets[k]) == vault.TypeBinary {
+					fmt.Fprintf(os.Stderr, "Error: secret '%s' is binary and can't be exported as %s; leave it out with --only or --prefix, or write it out with 'memevault get %s -o FILE'\n", k, exportFormat, k)
+					os.Exit(1)
+				}
+			}
+		}
+
+		out, err := format(secrets)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting secrets: %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVar(&exportFormat, "format", "dotenv", "Output format: dotenv, json, yaml, sh, fish, powershell, k8s-secret or docker-env")
+	exportCmd.Flags().StringSliceVar(&exportOnly, "only", nil, "Export only these keys (comma-separated or repeated)")
+	exportCmd.Flags().StringVar(&exportPrefix, "prefix", "", "Export only keys starting with this prefix")
+	exportCmd.Flags().StringVar(&exportName, "name", "", "Name of the Kubernetes Secret (k8s-secret)")
+	exportCmd.Flags().StringVar(&exportNamespace, "namespace", "", "Namespace of the Kubernetes Secret (k8s-secret)")
+}
@@ -3,59 +3,129 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
-	"sort"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
 )
 
+var explainGet bool
+var rawGet bool
+var getOutput string
+
 var getCmd = &cobra.Command{
 	Use:   "get [KEY]",
 	Short: "Get a secret value or list all secrets",
-	Long:  `Retrieve a specific secret by key, or list all secrets if no key is provided.`,
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Retrieve a specific secret by key, or list all secrets if no key is provided.
+Secrets inherited from parent environments are included; use --explain KEY to
+see which environment a value comes from. Templates (set --template) have
+their references to other keys (${KEY}) expanded unless --raw is given.
+
+Multiline values are printed as they are. Binary values are only shown as a
+size; use -o FILE to write a value's exact bytes to a file ("-" for stdout).`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		if keyFile == "" {
-			home, _ := os.UserHomeDir()
-			keyFile = filepath.Join(home, ".memevault", "keys", "memevault.key")
+		// Opening the vault checks access, since it has to be decrypted with
+		// one of the user's keys; without access this returns an error.
+		v, err := openVault()
+		if err != nil {
+			fmt.Printf("Error loading secrets: %v\n", err)
+			return
+		}
+
+		if getOutput != "" && (len(args) == 0 || explainGet) {
+			fmt.Println("Error: -o needs a KEY")
+			os.Exit(1)
 		}
 
-		// loadSecrets inherently checks access because it attempts to decrypt
-		// with the user's private key. If they don't have access, this returns error.
-		secrets, err := loadSecrets(vaultFile, keyFile)
+		if explainGet {
+			if len(args) == 0 {
+				fmt.Println("Error: --explain needs a KEY")
+				os.Exit(1)
+			}
+			explainKey(v, args[0])
+			return
+		}
+
+		// Only the requested key (and what it references) is expanded, and
+		// has to expand; listings skip broken templates with a warning
+		var secrets vault.SecretsMap
+		switch {
+		case rawGet:
+			secrets, err = v.Resolved()
+		case len(args) > 0:
+			secrets, err = v.Expanded(args...)
+		default:
+			secrets, err = expandSecrets(v)
+		}
 		if err != nil {
 			fmt.Printf("Error loading secrets: %v\n", err)
-			return
+			os.Exit(1)
 		}
 
 		if len(args) > 0 {
 			// Get specific key
 			key := args[0]
-			if val, ok := secrets[key]; ok {
-				fmt.Println(val)
-			} else {
+			val, ok := secrets[key]
+			if !ok {
 				fmt.Printf("Secret '%s' not found.\n", key)
 				os.Exit(1)
 			}
-		} else {
-			// List all keys
-			// Sort keys for consistent output
-			var keys []string
-			for k := range secrets {
-				if k == RecipientsKey {
-					continue
+			switch {
+			case getOutput != "":
+				if err := writeSecretFile(getOutput, []byte(val)); err != nil {
+					fmt.Printf("Error writing %s: %v\n", getOutput, err)
+					os.Exit(1)
 				}
-				keys = append(keys, k)
+			case vault.TypeOf(val) == vault.TypeBinary:
+				fmt.Printf("Secret '%s' is binary (%d bytes); use -o FILE to write it out.\n", key, len(val))
+				os.Exit(1)
+			default:
+				fmt.Println(val)
 			}
-			sort.Strings(keys)
-
-			for _, k := range keys {
-				fmt.Printf("%s=%q\n", k, secrets[k])
+		} else {
+			// List all keys (sorted for consistent output)
+			for _, k := range secrets.Keys() {
+				fmt.Printf("%s=%s\n", k, displayValue(secrets[k]))
 			}
 		}
 	},
 }
 
+// explainKey prints which environment in the inheritance chain provides key.
+func explainKey(v *vault.Vault, key string) {
+	layers, err := v.Layers()
+	if err != nil {
+		fmt.Printf("Error loading secrets: %v\n", err)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ENVIRONMENT\tVALUE\t")
+	found := false
+	for _, l := range layers {
+		val, ok := l.Secrets[key]
+		switch {
+		case !ok:
+			fmt.Fprintf(w, "%s\t-\t\n", l.Env)
+		case found:
+			fmt.Fprintf(w, "%s\t%s\t(overridden)\n", l.Env, displayValue(val))
+		default:
+			fmt.Fprintf(w, "%s\t%s\t(used)\n", l.Env, displayValue(val))
+			found = true
+		}
+	}
+	w.Flush()
+
+	if !found {
+		fmt.Printf("Secret '%s' not found.\n", key)
+		os.Exit(1)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(getCmd)
+	getCmd.Flags().BoolVar(&explainGet, "explain", false, "Show which environment the value of KEY comes from")
+	getCmd.Flags().BoolVar(&rawGet, "raw", false, "Show values without expanding ${KEY} references")
+	getCmd.Flags().StringVarP(&getOutput, "output", "o", "", "Write the exact bytes of KEY to a file (\"-\" for stdout)")
 }
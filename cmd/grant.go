@@ -2,8 +2,7 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -11,29 +10,33 @@ import (
 var grantCmd = &cobra.Command{
 	Use:   "grant [NAME] [PUBLIC_KEY]",
 	Short: "Grant access to another user (by public key)",
-	Args:  cobra.ExactArgs(2),
+	Long: `Grant access to another user by their memevault public key (age1...)
+or SSH public key (ssh-ed25519 or ssh-rsa, e.g. from github.com/USER.keys).`,
+	Args: cobra.MinimumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
-		key := args[1]
+		// Unquoted SSH keys arrive as "ssh-ed25519" "AAAA..." [comment]
+		key := strings.Join(args[1:], " ")
 
-		if keyFile == "" {
-			home, _ := os.UserHomeDir()
-			keyFile = filepath.Join(home, ".memevault", "keys", "memevault.key")
+		lock, err := lockVault()
+		if err != nil {
+			fmt.Printf("Error locking vault: %v\n", err)
+			return
 		}
+		defer lock.Unlock()
 
-		secrets, err := loadSecrets(vaultFile, keyFile)
+		v, err := openVault()
 		if err != nil {
 			fmt.Printf("Error loading secrets: %v\n", err)
 			return
 		}
 
-		recipients := getRecipients(secrets)
-
-		// TODO: Check if name/key already exists?
-		newRecipient := Recipient{Name: name, PublicKey: key}
-		recipients = append(recipients, newRecipient)
+		if err := v.Grant(name, key); err != nil {
+			fmt.Printf("Error granting access: %v\n", err)
+			return
+		}
 
-		if err := saveSecrets(vaultFile, secrets, recipients); err != nil {
+		if err := saveVault(v); err != nil {
 			fmt.Printf("Error granting access: %v\n", err)
 			return
 		}
@@ -44,5 +47,4 @@ var grantCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(grantCmd)
-	grantCmd.Flags().StringVar(&keyFile, "key", "", "Path to private key file")
 }
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/thoughtlesslabs/memevault/pkg/dotenv"
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
+)
+
+var onConflict string
+var importDryRun bool
+
+var importCmd = &cobra.Command{
+	Use:   "import [FILE]",
+	Short: "Import secrets from a .env file",
+	Long: `Imports every KEY=VALUE in a dotenv file ("-" for stdin) in a single save.
+Quotes, escapes, "export" prefixes and comments are understood.
+
+A preview of the changes is printed first:
+
+  + NEW_KEY       not in the vault yet
+  ~ CHANGED_KEY   in the vault with a different value
+  = SAME_KEY      already in the vault with this value
+  ! bad-key       can't be imported (the reason is shown)
+
+--on-conflict decides what happens to changed keys: prompt asks for each one
+(the default), overwrite replaces them and skip keeps the vault's values.
+When the file is read from stdin, --on-conflict skip or overwrite is required.
+Values are never printed. They are stored literally, so ${KEY} references
+in the file are not expanded; use set --template for values that need them.`,
+	Args: cobra.ExactArgs(1),
+	// Errors are returned once the vault is locked, so the lock is released
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if onConflict != "prompt" && onConflict != "overwrite" && onConflict != "skip" {
+			fmt.Printf("Error: invalid --on-conflict '%s' (use skip, overwrite or prompt)\n", onConflict)
+			os.Exit(1)
+		}
+
+		if args[0] == "-" && identityFromStdin() {
+			fmt.Println("Error: stdin can't supply both the file and the identity (--key -).")
+			os.Exit(1)
+		}
+		if args[0] == "-" && onConflict == "prompt" && !importDryRun {
+			fmt.Println("Error: can't ask about conflicts while the file is read from stdin; pass --on-conflict skip or --on-conflict overwrite.")
+			os.Exit(1)
+		}
+
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+
+		entries, err := dotenv.Parse(data)
+		if err != nil {
+			fmt.Printf("Error parsing %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			fmt.Println("Nothing to import.")
+			return nil
+		}
+
+		// Later assignments win, as when the file is sourced
+		values := map[string]string{}
+		var keys []string
+		for _, e := range entries {
+			if _, ok := values[e.Key]; !ok {
+				keys = append(keys, e.Key)
+			}
+			values[e.Key] = e.Value
+		}
+
+		lock, err := lockVault()
+		if err != nil {
+			fmt.Printf("Error locking vault: %v\n", err)
+			return nil
+		}
+		defer lock.Unlock()
+
+		v, err := openVault()
+		if err != nil {
+			fmt.Printf("Error loading secrets: %v\n", err)
+			return nil
+		}
+
+		var added, changed []string
+		invalid := 0
+		for _, key := range keys {
+			val := values[key]
+			switch existing, ok := v.Get(key); {
+			case !vault.ValidKey(key):
+				fmt.Printf("! %s (invalid key; keys must match [a-zA-Z_][a-zA-Z0-9_]*)\n", key)
+				invalid++
+			case strings.HasPrefix(key, vault.ReservedPrefix):
+				fmt.Printf("! %s (reserved; keys can't start with %s)\n", key, vault.ReservedPrefix)
+				invalid++
+			case !ok:
+				fmt.Printf("+ %s\n", key)
+				added = append(added, key)
+			case existing != val:
+				fmt.Printf("~ %s\n", key)
+				changed = append(changed, key)
+			default:
+				fmt.Printf("= %s\n", key)
+			}
+		}
+
+		if importDryRun {
+			fmt.Printf("Dry run: %d new, %d changed, %d invalid. Nothing was saved.\n", len(added), len(changed), invalid)
+			return nil
+		}
+
+		overwrite := changed
+		switch onConflict {
+		case "skip":
+			overwrite = nil
+		case "prompt":
+			overwrite = nil
+			for _, key := range changed {
+				if askForConfirmation(fmt.Sprintf("Key '%s' already exists. Overwrite?", key)) {
+					overwrite = append(overwrite, key)
+				}
+			}
+		}
+
+		if len(added)+len(overwrite) == 0 {
+			fmt.Println("No changes to import.")
+			return nil
+		}
+
+		for _, key := range append(added, overwrite...) {
+			if err := v.Set(key, values[key]); err != nil {
+				return err
+			}
+		}
+
+		if err := saveVault(v); err != nil {
+			fmt.Printf("Error saving secrets: %v\n", err)
+			return nil
+		}
+
+		fmt.Printf("Imported %d new and %d changed secret(s); skipped %d.\n", len(added), len(overwrite), len(changed)-len(overwrite)+invalid)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVar(&onConflict, "on-conflict", "prompt", "What to do with keys that already have a different value: skip, overwrite or prompt")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Show the preview without saving")
+}
@@ -12,6 +12,7 @@ import (
 
 var useMeme bool
 var sourceImage string
+var protectKey bool
 
 var initCmd = &cobra.Command{
 	Use:   "init",
@@ -27,11 +28,14 @@ var initCmd = &cobra.Command{
 		}
 
 		// 2. Load or Generate Keypair
-		var pub string
+		var pub, priv string
 		keyPath := filepath.Join(keyDir, "memevault.key")
 
 		if _, err := os.Stat(keyPath); err == nil {
 			fmt.Printf("Key already exists at %s. Using existing key.\n", keyPath)
+			if protectKey {
+				fmt.Println("Note: --passphrase only applies to newly created keys.")
+			}
 			// Load public key from file (stored as comment)
 			content, err := os.ReadFile(keyPath)
 			if err != nil {
@@ -51,15 +55,22 @@ var initCmd = &cobra.Command{
 				return
 			}
 		} else {
-			priv, newPub, err := vault.GenerateKey()
+			newPriv, newPub, err := vault.GenerateKey()
 			if err != nil {
 				fmt.Printf("Error generating key: %v\n", err)
 				return
 			}
-			pub = newPub
+			priv, pub = newPriv, newPub
 
-			err = os.WriteFile(keyPath, []byte(priv+"\n# Public Key: "+pub+"\n"), 0600)
-			if err != nil {
+			var passphrase string
+			if protectKey {
+				if passphrase, err = newPassphrase(); err != nil {
+					fmt.Printf("Error reading passphrase: %v\n", err)
+					return
+				}
+			}
+
+			if err := writeKeyFile(keyPath, priv, pub, passphrase); err != nil {
 				fmt.Printf("Error checking writing key: %v\n", err)
 				return
 			}
@@ -68,8 +79,6 @@ var initCmd = &cobra.Command{
 		}
 
 		// 3. Create Vault
-		initialSecrets := SecretsMap{"Example": "Welcome to Envault"}
-
 		// If meme requested or default to meme if no generic file
 		finalVaultPath := vaultFile
 		if filepath.Ext(finalVaultPath) == "" {
@@ -104,12 +113,36 @@ var initCmd = &cobra.Command{
 					return
 				}
 				finalVaultPath = filepath.Base(sourceImage) // simplistic
+				if capacity, err := vault.Capacity(data); err == nil {
+					fmt.Printf("Image capacity for --stego lsb: %d bytes\n", capacity)
+				} else {
+					fmt.Printf("Image can't hold an --stego lsb vault: %v\n", err)
+				}
 				os.WriteFile(finalVaultPath, data, 0644)
 			}
 
 			// Save secrets (only for new vault)
-			owner := Recipient{Name: "owner", PublicKey: pub}
-			if err := saveSecrets(finalVaultPath, initialSecrets, []Recipient{owner}); err != nil {
+			opts, err := vaultOptions()
+			if err != nil {
+				fmt.Printf("Error creating vault: %v\n", err)
+				return
+			}
+			v := vault.New(finalVaultPath, []vault.Recipient{{Name: "owner", PublicKey: pub}})
+			v.Options = opts
+			if priv == "" {
+				// Existing key: sign with it if we can load it
+				identity, _ := vault.LoadIdentityFromFile(keyPath)
+				for _, id := range vault.SplitIdentities(identity) {
+					if recipient, _ := vault.IdentityRecipient(id); recipient == pub {
+						priv = id
+					}
+				}
+			}
+			if priv != "" {
+				v.SignWith(priv)
+			}
+			v.Set("Example", "Welcome to Envault")
+			if err := saveVault(v); err != nil {
 				fmt.Printf("Error creating vault: %v\n", err)
 				return
 			}
@@ -123,4 +156,5 @@ func init() {
 	rootCmd.AddCommand(initCmd)
 	initCmd.Flags().BoolVar(&useMeme, "meme", false, "Use a random meme as the vault container")
 	initCmd.Flags().StringVar(&sourceImage, "image", "", "Use a specific image file as the vault container")
+	initCmd.Flags().BoolVar(&protectKey, "passphrase", false, "Encrypt the new private key with a passphrase")
 }
@@ -2,11 +2,9 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
 )
 
 var keysCmd = &cobra.Command{
@@ -18,24 +16,12 @@ var keysShowCmd = &cobra.Command{
 	Use:   "show",
 	Short: "Show your public key",
 	Run: func(cmd *cobra.Command, args []string) {
-		home, _ := os.UserHomeDir()
-		keyFile := filepath.Join(home, ".memevault", "keys", "memevault.key")
-
-		content, err := os.ReadFile(keyFile)
+		pub, err := publicKey()
 		if err != nil {
-			fmt.Printf("Error reading key file: %v\n", err)
+			fmt.Printf("Error reading key: %v\n", err)
 			return
 		}
-
-		// Parse comment for public key
-		lines := strings.Split(string(content), "\n")
-		for _, line := range lines {
-			if strings.HasPrefix(line, "# Public Key: ") {
-				fmt.Println(strings.TrimPrefix(line, "# Public Key: "))
-				return
-			}
-		}
-		fmt.Println("Error: Public key not found in key file")
+		fmt.Println(pub)
 	},
 }
 
@@ -43,3 +29,17 @@ func init() {
 	rootCmd.AddCommand(keysCmd)
 	keysCmd.AddCommand(keysShowCmd)
 }
+
+// writeKeyFile atomically writes an identity file with the public key stored
+// as a comment, so a crash never leaves a truncated key behind. A non-empty
+// passphrase encrypts the private key.
+func writeKeyFile(path string, priv string, pub string, passphrase string) error {
+	content := []byte(priv + "\n# Public Key: " + pub + "\n")
+	if passphrase != "" {
+		var err error
+		if content, err = vault.ProtectIdentity(priv, pub, passphrase); err != nil {
+			return err
+		}
+	}
+	return vault.WriteFileAtomic(path, content, 0600)
+}
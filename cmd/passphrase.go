@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
+	"golang.org/x/term"
+)
+
+// keyPassphrases caches the passphrase of each protected key (by the source
+// vault.PassphrasePrompt names) once entered, so a command never asks twice
+// for the same key and keys rotate can protect the new key with it.
+var keyPassphrases = map[string]string{}
+
+func init() {
+	vault.PassphrasePrompt = func(source string) (string, error) {
+		if pass, ok := keyPassphrases[source]; ok {
+			return pass, nil
+		}
+		pass, err := readPassphrase(fmt.Sprintf("Enter passphrase for %s: ", source))
+		if err != nil {
+			return "", err
+		}
+		keyPassphrases[source] = pass
+		return pass, nil
+	}
+}
+
+// readPassphrase reads a line from the terminal without echoing it.
+func readPassphrase(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("a passphrase is required but stdin is not a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(pass), nil
+}
+
+// newPassphrase asks for a new passphrase twice and checks both entries match.
+func newPassphrase() (string, error) {
+	pass, err := readPassphrase("Enter new passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass == "" {
+		return "", errors.New("passphrase cannot be empty")
+	}
+	confirm, err := readPassphrase("Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass != confirm {
+		return "", errors.New("passphrases do not match")
+	}
+	return pass, nil
+}
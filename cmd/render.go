@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+var renderOutput string
+var renderStrict bool
+
+// renderFuncs are the helpers available in templates on top of the
+// text/template builtins.
+var renderFuncs = template.FuncMap{
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"quote": strconv.Quote,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render [TEMPLATE]",
+	Short: "Render a config file template with secrets",
+	Long: `Renders a Go text/template with the vault's secrets as data, for tools that
+read secrets from a config file instead of the environment:
+
+  password: {{ .DB_PASSWORD | quote }}
+  token: {{ .API_TOKEN | base64 }}
+
+Besides the text/template builtins, the base64, quote and json functions are
+available. Missing keys render as empty strings unless --strict is given.
+The output is written with 0600 permissions.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		src, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Printf("Error reading template: %v\n", err)
+			os.Exit(1)
+		}
+
+		missingKey := "missingkey=zero"
+		if renderStrict {
+			missingKey = "missingkey=error"
+		}
+		tmpl, err := template.New(filepath.Base(args[0])).Funcs(renderFuncs).Option(missingKey).Parse(string(src))
+		if err != nil {
+			fmt.Printf("Error parsing template: %v\n", err)
+			os.Exit(1)
+		}
+
+		v, err := openVault()
+		if err != nil {
+			fmt.Printf("Error loading secrets: %v\n", err)
+			os.Exit(1)
+		}
+		secrets, err := expandSecrets(v)
+		if err != nil {
+			fmt.Printf("Error loading secrets: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Render fully before writing, so a failure never leaves a partial file
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, map[string]string(secrets)); err != nil {
+			fmt.Printf("Error rendering template: %v\n", err)
+			os.Exit(1)
+		}
+
+		if renderOutput == "" || renderOutput == "-" {
+			os.Stdout.Write(out.Bytes())
+			return
+		}
+
+		if err := writeSecretFile(renderOutput, out.Bytes()); err != nil {
+			fmt.Printf("Error writing output: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Rendered %s\n", renderOutput)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+	renderCmd.Flags().StringVarP(&renderOutput, "output", "o", "", "File to write (default: stdout)")
+	renderCmd.Flags().BoolVar(&renderStrict, "strict", false, "Fail on keys missing from the vault")
+}
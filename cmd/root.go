@@ -3,12 +3,20 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var cfgFile string
 var vaultFile string
+var keyFiles []string
+var lockTimeout time.Duration
+var stegoMode string
+var padding string
+var compress bool
+var verifyMode string
+var envName string
 
 const Version = "v1.2.1"
 
@@ -18,15 +26,24 @@ var rootCmd = &cobra.Command{
 	Short:   "A portable, secure environment variable manager (with memes)",
 	Long: `Memevault is a CLI tool to manage environment variables securely using Age encryption and steganography.
 It supports sharing secrets via encrypted files hidden inside memes.`,
+	// Execute prints errors, once
+	SilenceErrors: true,
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&vaultFile, "vault", "secrets.jpg", "Path to the vault file (encrypted file or meme)")
+	rootCmd.PersistentFlags().StringArrayVar(&keyFiles, "key", nil, "Path to private key file, or - to read it from stdin; repeat to try several keys (default: $MEMEVAULT_IDENTITY, $MEMEVAULT_KEY_FILE or ~/.memevault/keys/memevault.key)")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", 10*time.Second, "How long to wait for another process editing the vault")
+	rootCmd.PersistentFlags().StringVar(&stegoMode, "stego", "auto", "How to hide the vault in PNG/BMP images: auto (keep current), lsb (in the pixels) or none")
+	rootCmd.PersistentFlags().StringVar(&padding, "padding", "pow2", "Pad secrets so the vault size only changes at bucket boundaries: pow2, none or a block size in bytes")
+	rootCmd.PersistentFlags().BoolVar(&compress, "compress", true, "Compress secrets before encryption")
+	rootCmd.PersistentFlags().StringVar(&envName, "env", "", "Environment to use (default: $MEMEVAULT_ENV or \"default\")")
+	rootCmd.PersistentFlags().StringVar(&verifyMode, "verify", "warn", "Vault signature checks: warn (reject invalid signatures and changed signing keys, warn about unsigned vaults and untrusted signers), strict or off")
 }
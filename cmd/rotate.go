@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -14,36 +13,47 @@ var keysRotateCmd = &cobra.Command{
 	Use:   "rotate",
 	Short: "Rotate your private key (re-encrypt vault and replace key)",
 	Long: `Generates a new keypair, re-encrypts the vault to allow the new key 
-and revoke the old one, and replaces your local key file (backing up the old one).`,
+and revoke the old one, and replaces your local key file (backing up the old one).
+Every environment the old key can open is re-encrypted in the same save.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		home, _ := os.UserHomeDir()
-		if keyFile == "" {
-			keyFile = filepath.Join(home, ".memevault", "keys", "memevault.key")
+		keyPath := identityFile()
+		if keyPath == "" {
+			fmt.Println("Error: keys rotate needs a single identity file to replace; it can't rotate a key from $MEMEVAULT_IDENTITY, stdin or several --key flags.")
+			return
+		}
+
+		lock, err := lockVault()
+		if err != nil {
+			fmt.Printf("Error locking vault: %v\n", err)
+			return
 		}
+		defer lock.Unlock()
 
 		// 1. Load current secrets with OLD key
 		fmt.Println("Loading vault with current key...")
-		secrets, err := loadSecrets(vaultFile, keyFile)
+		v, err := openVault()
 		if err != nil {
 			fmt.Printf("Error loading secrets: %v\n", err)
 			return
 		}
 
 		// 2. Load Old Public Key to identify it in the list
-		oldKeyContent, err := os.ReadFile(keyFile)
+		oldKeyContent, err := os.ReadFile(keyPath)
 		if err != nil {
 			fmt.Printf("Error reading key file: %v\n", err)
 			return
 		}
-		var oldPubKey string
-		for _, line := range strings.Split(string(oldKeyContent), "\n") {
-			if strings.HasPrefix(line, "# Public Key: ") {
-				oldPubKey = strings.TrimSpace(strings.TrimPrefix(line, "# Public Key: "))
-				break
-			}
+		if identity, _ := loadIdentity(); len(vault.SplitIdentities(identity)) > 1 {
+			fmt.Printf("Error: %s holds several keys; keys rotate only replaces single-key files.\n", keyPath)
+			return
 		}
-		if oldPubKey == "" {
-			fmt.Println("Could not determine old public key from file. Aborting.")
+		oldPubKey, err := publicKey()
+		if err != nil {
+			fmt.Printf("Could not determine old public key (%v). Aborting.\n", err)
+			return
+		}
+		if (vault.Recipient{PublicKey: oldPubKey}).Type() != "age" {
+			fmt.Println("Error: keys rotate only replaces memevault keys. Rotate SSH keys with ssh-keygen, then grant the new key and remove the old one.")
 			return
 		}
 
@@ -55,50 +65,45 @@ and revoke the old one, and replaces your local key file (backing up the old one
 			return
 		}
 
-		// 4. Update Recipients List
-		currentRecipients := getRecipients(secrets)
-		var newRecipients []Recipient
+		// 4. Swap the old key for the new one in every environment it can open
 		found := false
-		for _, r := range currentRecipients {
-			if r.PublicKey == oldPubKey {
-				// Replace old with new, keep name
-				newRecipients = append(newRecipients, Recipient{Name: r.Name, PublicKey: newPub})
-				found = true
-			} else {
-				// Keep others
-				newRecipients = append(newRecipients, r)
-			}
+		for _, r := range v.Recipients() {
+			found = found || r.PublicKey == oldPubKey
 		}
-
 		// If for some reason we weren't in the list (maybe single user implicit mode?), just add new.
 		if !found {
 			fmt.Println("Warning: Old key was not found in recipients list (maybe it was implicit?). Adding new key anyway.")
-			newRecipients = append(newRecipients, Recipient{Name: "rotated-key", PublicKey: newPub})
+		}
+		envs, err := v.ReplaceKey(oldPubKey, newPriv)
+		if err != nil {
+			fmt.Printf("Error re-encrypting vault: %v\n", err)
+			return
 		}
 
-		// 5. Save/Re-encrypt with NEW recipients
-		// We need to update the internal recipients map too
-		fmt.Println("Re-encrypting vault...")
-		if err := saveSecrets(vaultFile, secrets, newRecipients); err != nil {
+		// 5. Save/Re-encrypt with NEW recipients (all environments in one write)
+		fmt.Printf("Re-encrypting vault (environments: %s)...\n", strings.Join(envs, ", "))
+		if err := saveVault(v); err != nil {
 			fmt.Printf("Error saving vault: %v\n", err)
 			return
 		}
 
 		// 6. Backup Old Key
-		backupPath := keyFile + ".bak"
+		// Copy rather than rename so the key file is never missing if we crash.
+		backupPath := keyPath + ".bak"
 		fmt.Printf("Backing up old key to %s...\n", backupPath)
-		if err := os.Rename(keyFile, backupPath); err != nil {
+		if err := vault.WriteFileAtomic(backupPath, oldKeyContent, 0600); err != nil {
 			fmt.Printf("Error backing up key: %v. \nCRITICAL: New key is NOT saved yet! New private key is:\n%s\nSave this manually!!\n", err, newPriv)
 			return
 		}
 
-		// 7. Write New Key
+		// 7. Write New Key (protected with the old passphrase, if any)
 		fmt.Println("Saving new key...")
-		err = os.WriteFile(keyFile, []byte(newPriv+"\n# Public Key: "+newPub+"\n"), 0600)
-		if err != nil {
-			fmt.Printf("Error writing new key: %v.\nCRITICAL: Restore backup from %s immediately or save this private key:\n%s\n", err, backupPath, newPriv)
-			// Try to revert backup?
-			os.Rename(backupPath, keyFile)
+		passphrase := ""
+		if vault.IsProtectedIdentity(oldKeyContent) {
+			passphrase = keyPassphrases[keyPath]
+		}
+		if err := writeKeyFile(keyPath, newPriv, newPub, passphrase); err != nil {
+			fmt.Printf("Error writing new key: %v.\nCRITICAL: The vault is now encrypted to the new key only. Save this private key:\n%s\n", err, newPriv)
 			return
 		}
 
@@ -109,5 +114,4 @@ and revoke the old one, and replaces your local key file (backing up the old one
 
 func init() {
 	keysCmd.AddCommand(keysRotateCmd)
-	keysRotateCmd.Flags().StringVar(&keyFile, "key", "", "Path to private key file")
 }
@@ -4,24 +4,22 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
 )
 
-var keyFile string
-
 var runCmd = &cobra.Command{
 	Use:   "run -- [command]",
 	Short: "Run a command with secrets loaded",
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		if keyFile == "" {
-			home, _ := os.UserHomeDir()
-			keyFile = filepath.Join(home, ".memevault", "keys", "memevault.key")
+		v, err := openVault()
+		if err != nil {
+			fmt.Printf("Error loading secrets: %v\n", err)
+			os.Exit(1)
 		}
-
-		secrets, err := loadSecrets(vaultFile, keyFile)
+		secrets, err := expandSecrets(v)
 		if err != nil {
 			fmt.Printf("Error loading secrets: %v\n", err)
 			os.Exit(1)
@@ -38,15 +36,16 @@ var runCmd = &cobra.Command{
 
 		// Inject environment
 		env := os.Environ()
-		for k, v := range secrets {
-			if k == RecipientsKey {
+		for _, k := range secrets.Keys() {
+			if !vault.ValidKey(k) {
+				fmt.Fprintf(os.Stderr, "Warning: Skipping invalid key '%s' found in vault.\n", k)
 				continue
 			}
-			if !isValidKey(k) {
-				fmt.Fprintf(os.Stderr, "Warning: Skipping invalid key '%s' found in vault.\n", k)
+			if vault.TypeOf(secrets[k]) == vault.TypeBinary {
+				fmt.Fprintf(os.Stderr, "Warning: Skipping binary secret '%s'; use 'memevault get %s -o FILE' to write it to a file.\n", k, k)
 				continue
 			}
-			env = append(env, fmt.Sprintf("%s=%s", k, v))
+			env = append(env, fmt.Sprintf("%s=%s", k, secrets[k]))
 		}
 
 		// Polyfill: Check if command is "printenv"
@@ -90,5 +89,4 @@ var runCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(runCmd)
-	runCmd.Flags().StringVar(&keyFile, "key", "", "Path to private key file")
 }
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
 )
 
 var scanCmd = &cobra.Command{
@@ -89,13 +90,12 @@ indicating environment variable usage (e.g. os.Getenv("VAR"), process.env.VAR).`
 		}
 
 		// Check against vault
-		home, _ := os.UserHomeDir()
-		if keyFile == "" {
-			keyFile = filepath.Join(home, ".memevault", "keys", "memevault.key")
-		}
-
 		fmt.Println("\nChecking against vault...")
-		secrets, err := loadSecrets(vaultFile, keyFile)
+		var secrets vault.SecretsMap
+		vlt, err := openVault()
+		if err == nil {
+			secrets, err = vlt.Resolved()
+		}
 		missing := []string{}
 
 		if err == nil {
@@ -125,5 +125,4 @@ indicating environment variable usage (e.g. os.Getenv("VAR"), process.env.VAR).`
 
 func init() {
 	rootCmd.AddCommand(scanCmd)
-	scanCmd.Flags().StringVar(&keyFile, "key", "", "Path to private key file")
 }
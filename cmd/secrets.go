@@ -1,153 +1,231 @@
 package cmd
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/thoughtlesslabs/memevault/pkg/vault"
 )
 
-type SecretsMap map[string]string
-
-const RecipientsKey = "_memevault_recipients"
-
-type Recipient struct {
-	Name      string `json:"name"`
-	PublicKey string `json:"public_key"`
+// lockVault takes the exclusive vault lock for a load-modify-save cycle.
+// Callers must hold it from before openVault until after Save.
+func lockVault() (*vault.Lock, error) {
+	lock, err := vault.LockFile(vaultFile, lockTimeout)
+	if errors.Is(err, vault.ErrLocked) {
+		return nil, fmt.Errorf("%v. Another memevault command is editing the vault; retry or raise --lock-timeout", err)
+	}
+	return lock, err
 }
 
-func getRecipients(secrets SecretsMap) []Recipient {
-	val, ok := secrets[RecipientsKey]
-	if !ok {
-		return []Recipient{}
+// vaultOptions builds the vault file options from --stego, --padding,
+// --compress, --verify, --env and the MEMEVAULT_STEGO_KEY and MEMEVAULT_ENV
+// environment variables.
+func vaultOptions() (vault.Options, error) {
+	mode, err := vault.ParseStegoMode(stegoMode)
+	if err != nil {
+		return vault.Options{}, err
 	}
+	pad, err := vault.ParsePadding(padding)
+	if err != nil {
+		return vault.Options{}, err
+	}
+	verify, err := vault.ParseVerifyMode(verifyMode)
+	if err != nil {
+		return vault.Options{}, err
+	}
+	opts := vault.Options{Stego: mode, Padding: pad, Compress: compress, Verify: verify, Env: envName, KnownSigners: vault.DefaultKnownSignersFile()}
+	if opts.Env == "" {
+		opts.Env = os.Getenv(vault.EnvName)
+	}
+	if key := os.Getenv(vault.EnvStegoKey); key != "" {
+		opts.StegoKey = []byte(key)
+	}
+	return opts, nil
+}
+
+// stdinIdentity caches an identity read with "--key -", since stdin can
+// only be consumed once.
+var stdinIdentity string
 
-	// Try parsing as new format
-	var recipients []Recipient
-	if err := json.Unmarshal([]byte(val), &recipients); err == nil {
-		return recipients
+// loadIdentity resolves the identities from every --key, or else from
+// MEMEVAULT_IDENTITY, MEMEVAULT_KEY_FILE or the default key file.
+// "--key -" reads them from stdin.
+func loadIdentity() (string, error) {
+	if len(keyFiles) == 0 {
+		return vault.LoadIdentity("")
 	}
 
-	// Fallback: Try parsing as old format ([]string)
-	var keys []string
-	if err := json.Unmarshal([]byte(val), &keys); err == nil {
-		// Migrate
-		migrated := make([]Recipient, len(keys))
-		for i, k := range keys {
-			migrated[i] = Recipient{Name: fmt.Sprintf("legacy-%s", k[:8]), PublicKey: k}
+	var ids []string
+	for _, path := range keyFiles {
+		if path != "-" {
+			id, err := vault.LoadIdentityFromFile(path)
+			if err != nil {
+				return "", err
+			}
+			ids = append(ids, id)
+			continue
 		}
-		return migrated
+		if stdinIdentity == "" {
+			id, err := vault.LoadIdentityFromReader(os.Stdin)
+			if err != nil {
+				return "", err
+			}
+			stdinIdentity = id
+		}
+		ids = append(ids, stdinIdentity)
 	}
+	return strings.Join(ids, "\n"), nil
+}
 
-	return []Recipient{}
+// identityFromStdin reports whether "--key -" reads the identity from stdin,
+// so nothing else can.
+func identityFromStdin() bool {
+	return slices.Contains(keyFiles, "-")
 }
 
-func setRecipients(secrets SecretsMap, recipients []Recipient) {
-	data, _ := json.Marshal(recipients)
-	secrets[RecipientsKey] = string(data)
+// identityFile returns the single key file the identity is read from, or ""
+// when it comes from MEMEVAULT_IDENTITY, stdin or several --key flags.
+func identityFile() string {
+	switch {
+	case len(keyFiles) > 1:
+		return ""
+	case len(keyFiles) == 1 && keyFiles[0] == "-":
+		return ""
+	case len(keyFiles) == 1:
+		return keyFiles[0]
+	}
+	return vault.ResolveKeyFile("")
 }
 
-func loadSecrets(vaultPath string, keyFile string) (SecretsMap, error) {
-	// Read encrypted payload
-	payload, err := vault.Extract(vaultPath)
-	if err != nil {
-		// Try reading as raw file if extraction fails (maybe not an image?)
-		// For now simple fallback
-		raw, err2 := os.ReadFile(vaultPath)
-		if err2 != nil {
-			return nil, fmt.Errorf("failed to read vault file: %v (also failed extract: %v)", err2, err)
+// publicKey returns the public key of the current identity, preferring the
+// "# Public Key:" comment in the key file so no secret material is parsed.
+func publicKey() (string, error) {
+	if path := identityFile(); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.HasPrefix(line, "# Public Key: ") {
+				return strings.TrimSpace(strings.TrimPrefix(line, "# Public Key: ")), nil
+			}
 		}
-		payload = raw
 	}
 
-	// Decrypt
-	identity, err := vault.LoadIdentityFromFile(keyFile)
+	identity, err := loadIdentity()
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	keys, err := vault.IdentityRecipients(identity)
+	if err != nil {
+		return "", err
 	}
+	return keys[0], nil
+}
 
-	decrypted, err := vault.Decrypt(payload, identity)
+// openVault decrypts the vault with the current identity. When several keys
+// are loaded, the one that matched is reported on stderr, as are newly
+// trusted signers and signatures that --verify warn lets through.
+func openVault() (*vault.Vault, error) {
+	opts, err := vaultOptions()
 	if err != nil {
-		return nil, fmt.Errorf("decryption failed: %v", err)
+		return nil, err
 	}
 
-	var secrets SecretsMap
-	if err := json.Unmarshal(decrypted, &secrets); err != nil {
-		return nil, fmt.Errorf("invalid json payload: %v", err)
+	identity, err := loadIdentity()
+	if err != nil {
+		return nil, err
 	}
 
-	return secrets, nil
-}
+	v, err := vault.OpenWithOptions(vaultFile, identity, opts)
+	if errors.Is(err, vault.ErrSignerChanged) {
+		return nil, fmt.Errorf("%v; if they really changed keys, check the signing key in 'memevault access list --verify off' with them and run 'memevault access trust NAME'", err)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-func saveSecrets(vaultPath string, secrets SecretsMap, recipients []Recipient) error {
-	// Update internal metadata
-	setRecipients(secrets, recipients)
+	if len(vault.SplitIdentities(identity)) > 1 {
+		key := v.OpenedWith()
+		for _, r := range v.Recipients() {
+			if r.PublicKey == key {
+				key = fmt.Sprintf("%s (%s)", r.Name, key)
+				break
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Decrypted with key %s\n", key)
+	}
 
-	// Extract just keys for encryption
-	var keys []string
-	for _, r := range recipients {
-		keys = append(keys, r.PublicKey)
+	for _, r := range v.NewlyTrusted() {
+		fmt.Fprintf(os.Stderr, "Trusting signatures by %s (%s) from now on.\n", r.Name, r.PublicKey)
 	}
+	warnPinError(v)
+	if signer, err := v.Signer(); errors.Is(err, vault.ErrUnsigned) {
+		fmt.Fprintln(os.Stderr, "Warning: vault is not signed; it will be signed the next time it is saved.")
+	} else if errors.Is(err, vault.ErrUntrustedSigner) {
+		fmt.Fprintf(os.Stderr, "Warning: %v (%s). Check their signing key in 'memevault access list' with them, then run 'memevault access trust %s'.\n", err, signer.PublicKey, signer.Name)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v (%s). Check who last wrote the vault.\n", err, signer.PublicKey)
+	}
+	return v, nil
+}
 
-	data, err := json.Marshal(secrets)
-	if err != nil {
+// saveVault saves v, warning if the signers it vouches for couldn't be
+// pinned.
+func saveVault(v *vault.Vault) error {
+	if err := v.Save(); err != nil {
 		return err
 	}
+	warnPinError(v)
+	return nil
+}
 
-	encrypted, err := vault.Encrypt(data, keys)
-	if err != nil {
-		return err
+// warnPinError reports signing keys that couldn't be recorded in the known
+// signers file, e.g. because the home directory is read-only in CI. The
+// vault is still usable, but they will be pinned again on the next run.
+func warnPinError(v *vault.Vault) {
+	if err := v.PinError(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 	}
+}
 
-	// Check if vaultPath is an image
-	ext := filepath.Ext(vaultPath)
-	if ext == ".jpg" || ext == ".png" || ext == ".jpeg" {
-		// It's an image, we need to re-embed.
-		// NOTE: This implementation is destructive if we don't have the original image separately.
-		// For a "vault" file that IS the image, we can't easily stripping the old payload without parsing.
-		// Simpler approach for MVP: Expect the vaultPath to ALREADY be the image source.
-		// But if we are UPDATING, we are just appending.
-		// Wait, if I append to an image that already has a payload, I corrupt it or make it double payload.
-		// FIX: We need a way to store the "clean" image or strip the payload.
-		// IMPLEMENTATION SHORTCUT: We will not support "updating" the image in place perfectly without a clean source.
-		// OR: We check for magic bytes, and if found, we truncate the file before appending new payload.
-
-		f, err := os.OpenFile(vaultPath, os.O_RDWR, 0644)
-		if err == nil {
-			stat, _ := f.Stat()
-			fileSize := stat.Size()
-
-			// Check if it already has payload
-			magicBuf := make([]byte, len(vault.MagicBytes))
-			f.ReadAt(magicBuf, fileSize-int64(len(vault.MagicBytes)))
-
-			if string(magicBuf) == string(vault.MagicBytes) {
-				// It has a payload. Read length to find where to truncate.
-				lengthBuf := make([]byte, 8)
-				lengthPos := fileSize - int64(len(vault.MagicBytes)) - 8
-				f.ReadAt(lengthBuf, lengthPos)
-				// We don't even need the length, we just need to know it's there.
-				// Actually, we need to find the START of the payload to truncate there.
-				// But wait, the previous code doesn't store the start offset explicitly, it's calculated.
-				// Let's rely on Extract to get the payload length, then calculate start.
-
-				// Re-extract to find old payload size
-				oldPayload, err := vault.Extract(vaultPath)
-				if err == nil {
-					// total overhead = len(oldPayload) + 8 (len) + len(magic)
-					overhead := int64(len(oldPayload) + 8 + len(vault.MagicBytes))
-					truncateAt := fileSize - overhead
-					f.Truncate(truncateAt)
-				}
-			}
-			f.Close()
+// expandSecrets expands the templates among keys (every secret when none are
+// given), warning about and leaving out those that can't be expanded, e.g.
+// because a key they reference was unset.
+func expandSecrets(v *vault.Vault, keys ...string) (vault.SecretsMap, error) {
+	secrets, err := v.Expanded(keys...)
+	var broken *vault.TemplateError
+	if errors.As(err, &broken) {
+		for _, k := range broken.Keys() {
+			fmt.Fprintf(os.Stderr, "Warning: %v; skipping '%s'.\n", broken.Errs[k], k)
 		}
+		return secrets, nil
+	}
+	return secrets, err
+}
 
-		return vault.Embed(vaultPath, encrypted)
+// writeSecretFile writes data to path atomically with 0600 permissions, or
+// to stdout for "-".
+func writeSecretFile(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	// WriteFileAtomic keeps an existing file's mode, so tighten it first
+	if err := os.Chmod(path, 0600); err != nil && !os.IsNotExist(err) {
+		return err
 	}
+	return vault.WriteFileAtomic(path, data, 0600)
+}
 
-	// Normal file
-	return os.WriteFile(vaultPath, encrypted, 0644)
+// displayValue formats a secret for listings: quoted text, or a size note for
+// binary values.
+func displayValue(val string) string {
+	if vault.TypeOf(val) == vault.TypeBinary {
+		return fmt.Sprintf("<binary, %d bytes>", len(val))
+	}
+	return fmt.Sprintf("%q", val)
 }
@@ -2,76 +2,149 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-
-	"regexp"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
+	"golang.org/x/term"
 )
 
 var forceSet bool
+var setFromFile string
+var setTemplate bool
 
 var setCmd = &cobra.Command{
 	Use:   "set [KEY] [VALUE]",
 	Short: "Set a secret value",
-	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Stores a secret. To keep the value out of shell history and ps output, leave
+VALUE out to type it at a hidden prompt, or give "-" to read it from stdin
+(a single trailing newline is dropped).
+
+Values may span lines; use --from-file to store the exact contents of a file
+such as a PEM certificate ("-" reads stdin). Files that aren't UTF-8 text are
+stored as binary; get -o writes them back out.
+
+Values are stored literally. With --template, ${KEY} references to other
+secrets are expanded whenever the value is read ($$ is a literal $):
+
+  memevault set --template DATABASE_URL 'postgres://${DB_USER}:${DB_PASSWORD}@db/app'`,
+	Args: cobra.RangeArgs(1, 2),
+	// Errors are returned once the vault is locked, so the lock is released
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
 		key := args[0]
-		val := args[1]
 
-		if !isValidKey(key) {
+		if !vault.ValidKey(key) {
 			fmt.Printf("Error: Key '%s' contains invalid characters. Keys must match [a-zA-Z_][a-zA-Z0-9_]*\n", key)
 			os.Exit(1)
 		}
 
-		if strings.ContainsAny(val, "\n\r") {
-			fmt.Println("Error: Value contains newlines or control characters, which can cause injection issues.")
+		fromStdin := setFromFile == "-" || (len(args) == 2 && args[1] == "-")
+		if fromStdin && identityFromStdin() {
+			fmt.Println("Error: stdin can't supply both the value and the identity (--key -). Read the value with --from-file PATH, or the key from a file or $MEMEVAULT_IDENTITY.")
 			os.Exit(1)
 		}
 
-		if keyFile == "" {
-			home, _ := os.UserHomeDir()
-			keyFile = filepath.Join(home, ".memevault", "keys", "memevault.key")
+		var val string
+		switch {
+		case setFromFile != "" && len(args) == 2:
+			fmt.Println("Error: Give either a VALUE or --from-file, not both.")
+			os.Exit(1)
+		case setFromFile != "":
+			data, err := readValueFile(setFromFile)
+			if err != nil {
+				fmt.Printf("Error reading value: %v\n", err)
+				os.Exit(1)
+			}
+			val = string(data)
+		case len(args) == 2 && args[1] == "-":
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Printf("Error reading value: %v\n", err)
+				os.Exit(1)
+			}
+			val = strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+		case len(args) == 2:
+			val = args[1]
+		default:
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				fmt.Println("Error: Missing VALUE. Pass \"-\" to read it from stdin, or use --from-file.")
+				os.Exit(1)
+			}
+			var err error
+			if val, err = readPassphrase(fmt.Sprintf("Value for %s: ", key)); err != nil {
+				fmt.Printf("Error reading value: %v\n", err)
+				os.Exit(1)
+			}
+			if val == "" {
+				fmt.Println("Error: No value entered.")
+				os.Exit(1)
+			}
+		}
+
+		lock, err := lockVault()
+		if err != nil {
+			fmt.Printf("Error locking vault: %v\n", err)
+			return nil
 		}
+		defer lock.Unlock()
 
-		secrets, err := loadSecrets(vaultFile, keyFile)
+		v, err := openVault()
 		if err != nil {
 			fmt.Printf("Error loading secrets: %v\n", err)
-			return
+			return nil
 		}
 
 		// Check for overwrite
-		if existing, ok := secrets[key]; ok {
-			if existing != val && !forceSet {
+		if existing, ok := v.Get(key); ok {
+			if (existing != val || v.IsTemplate(key) != setTemplate) && !forceSet {
+				// The answer can't be read from stdin once the value came from it
+				if fromStdin && !term.IsTerminal(int(os.Stdin.Fd())) {
+					return fmt.Errorf("Key '%s' already exists. Use -f to overwrite it with a value from stdin.", key)
+				}
 				if !askForConfirmation(fmt.Sprintf("Key '%s' already exists. Overwrite?", key)) {
 					fmt.Println("Aborted.")
-					return
+					return nil
 				}
 			}
 		}
 
-		secrets[key] = val
-
-		// Preserve existing recipients
-		recipients := getRecipients(secrets)
+		set := v.Set
+		if setTemplate {
+			set = v.SetTemplate
+		}
+		if err := set(key, val); err != nil {
+			return err
+		}
 
-		if err := saveSecrets(vaultFile, secrets, recipients); err != nil {
+		if err := saveVault(v); err != nil {
 			fmt.Printf("Error saving secrets: %v\n", err)
-			return
+			return nil
 		}
 
-		fmt.Printf("Set %s\n", key)
+		if vault.TypeOf(val) == vault.TypeBinary {
+			fmt.Printf("Set %s (binary, %d bytes)\n", key, len(val))
+		} else {
+			fmt.Printf("Set %s\n", key)
+		}
+		return nil
 	},
 }
 
+// readValueFile reads a secret value from a file, or from stdin for "-".
+// The contents are used as they are, including any trailing newline.
+func readValueFile(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
 func init() {
 	rootCmd.AddCommand(setCmd)
 	setCmd.Flags().BoolVarP(&forceSet, "force", "f", false, "Skip confirmation prompt")
-}
-
-func isValidKey(key string) bool {
-	matched, _ := regexp.MatchString(`^[a-zA-Z_][a-zA-Z0-9_]*$`, key)
-	return matched
+	setCmd.Flags().BoolVar(&setTemplate, "template", false, "Expand ${KEY} references to other secrets in the value when it is read")
+	setCmd.Flags().StringVar(&setFromFile, "from-file", "", "Read the value from a file (\"-\" for stdin)")
 }
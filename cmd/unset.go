@@ -3,7 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -17,22 +17,49 @@ var unsetCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		key := args[0]
 
-		if keyFile == "" {
-			home, _ := os.UserHomeDir()
-			keyFile = filepath.Join(home, ".memevault", "keys", "memevault.key")
+		lock, err := lockVault()
+		if err != nil {
+			fmt.Printf("Error locking vault: %v\n", err)
+			return
 		}
+		defer lock.Unlock()
 
-		secrets, err := loadSecrets(vaultFile, keyFile)
+		v, err := openVault()
 		if err != nil {
 			fmt.Printf("Error loading secrets: %v\n", err)
 			return
 		}
 
-		if _, ok := secrets[key]; !ok {
+		if _, ok := v.Get(key); !ok {
+			if v.Parent() != "" {
+				fmt.Printf("Key '%s' is not set in '%s' (inherited values must be unset in the environment that sets them; see get --explain).\n", key, v.Env())
+				return
+			}
 			fmt.Printf("Key '%s' not found in vault.\n", key)
 			return
 		}
 
+		// Templates using the key stop expanding, unless a parent environment
+		// still provides it. Nothing is written until the vault is saved.
+		refs, err := v.References(key)
+		if err != nil {
+			fmt.Printf("Error loading secrets: %v\n", err)
+			return
+		}
+		v.Delete(key)
+		resolved, err := v.Resolved()
+		if err != nil {
+			fmt.Printf("Error loading secrets: %v\n", err)
+			return
+		}
+		if _, inherited := resolved[key]; len(refs) > 0 && !inherited {
+			if !forceUnset {
+				fmt.Printf("Key '%s' is used by the templates %s; change them first, or pass --force to remove it anyway.\n", key, strings.Join(refs, ", "))
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Warning: the templates %s will no longer expand without '%s'.\n", strings.Join(refs, ", "), key)
+		}
+
 		if !forceUnset {
 			if !askForConfirmation(fmt.Sprintf("Are you sure you want to delete '%s'?", key)) {
 				fmt.Println("Aborted.")
@@ -40,12 +67,7 @@ var unsetCmd = &cobra.Command{
 			}
 		}
 
-		delete(secrets, key)
-
-		// Preserve existing recipients
-		recipients := getRecipients(secrets)
-
-		if err := saveSecrets(vaultFile, secrets, recipients); err != nil {
+		if err := saveVault(v); err != nil {
 			fmt.Printf("Error saving secrets: %v\n", err)
 			return
 		}
@@ -56,5 +78,5 @@ var unsetCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(unsetCmd)
-	unsetCmd.Flags().BoolVarP(&forceUnset, "force", "f", false, "Skip confirmation prompt")
+	unsetCmd.Flags().BoolVarP(&forceUnset, "force", "f", false, "Skip confirmation prompt, and remove keys templates still use")
 }
@@ -5,11 +5,13 @@ go 1.21
 require (
 	filippo.io/age v1.1.1
 	github.com/spf13/cobra v1.8.0
+	golang.org/x/crypto v0.4.0
+	golang.org/x/sys v0.10.0
+	golang.org/x/term v0.10.0
 )
 
 require (
+	filippo.io/edwards25519 v1.0.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/crypto v0.4.0 // indirect
-	golang.org/x/sys v0.3.0 // indirect
 )
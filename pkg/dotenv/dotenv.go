@@ -0,0 +1,240 @@
+// Package dotenv parses .env files.
+//
+// The accepted syntax is the common subset understood by docker compose,
+// godotenv and friends:
+//
+//	# comment
+//	export KEY=value          # inline comments need a space before the #
+//	KEY="double quoted\n"     # \n \r \t \" \\ and \$ escapes; may span lines
+//	KEY='single quoted'       # taken literally; may span lines
+//
+// Variable references ($VAR, ${VAR}) are not expanded; values are returned as
+// written, apart from quotes and escapes.
+package dotenv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Entry is a single KEY=VALUE assignment.
+type Entry struct {
+	Key   string
+	Value string
+	// Line is the 1-based line the assignment starts on.
+	Line int
+}
+
+// Parse returns the assignments in data in file order. Keys are returned as
+// written; callers decide which names they accept. Later assignments to the
+// same key are returned too, so callers can apply them in order.
+func Parse(data []byte) ([]Entry, error) {
+	p := &parser{src: strings.ReplaceAll(string(data), "\r\n", "\n"), line: 1}
+	var entries []Entry
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return entries, nil
+		}
+		e, err := p.entry()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", e.Line, err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	return p.src[p.pos]
+}
+
+func (p *parser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipBlank skips whitespace, empty lines and comment lines.
+func (p *parser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\n':
+			p.next()
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.next()
+	}
+}
+
+func (p *parser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+func (p *parser) entry() (Entry, error) {
+	e := Entry{Line: p.line}
+
+	key := p.word()
+	if key == "export" {
+		p.skipSpaces()
+		if !p.eof() && p.peek() != '=' {
+			key = p.word()
+		}
+	}
+	if key == "" {
+		return e, fmt.Errorf("expected KEY=VALUE")
+	}
+	e.Key = key
+
+	p.skipSpaces()
+	if p.eof() || p.peek() != '=' {
+		return e, fmt.Errorf("expected = after %s", key)
+	}
+	p.next()
+	p.skipSpaces()
+
+	var err error
+	switch {
+	case p.eof():
+	case p.peek() == '"':
+		e.Value, err = p.doubleQuoted()
+	case p.peek() == '\'':
+		e.Value, err = p.singleQuoted()
+	default:
+		e.Value = p.unquoted()
+		return e, nil
+	}
+	if err != nil {
+		return e, err
+	}
+
+	// Only whitespace or a comment may follow a quoted value
+	p.skipSpaces()
+	if !p.eof() && p.peek() != '\n' && p.peek() != '#' {
+		return e, fmt.Errorf("unexpected characters after quoted value of %s", key)
+	}
+	p.skipLine()
+	return e, nil
+}
+
+// word reads a key: everything up to whitespace or =.
+func (p *parser) word() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == '=' || c == ' ' || c == '\t' || c == '\n' {
+			break
+		}
+		p.next()
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) unquoted() string {
+	start := p.pos
+	end := len(p.src)
+	if i := strings.IndexByte(p.src[start:], '\n'); i >= 0 {
+		end = start + i
+	}
+	val := p.src[start:end]
+	// The spaces before the value are already skipped, so a # at its start
+	// begins a comment too
+	for i := 0; i < len(val); i++ {
+		if val[i] == '#' && (i == 0 || val[i-1] == ' ' || val[i-1] == '\t') {
+			val = val[:i]
+			break
+		}
+	}
+	for p.pos < end {
+		p.next()
+	}
+	return strings.TrimSpace(val)
+}
+
+func (p *parser) singleQuoted() (string, error) {
+	p.next()
+	var b strings.Builder
+	for !p.eof() {
+		c := p.next()
+		if c == '\'' {
+			return b.String(), nil
+		}
+		b.WriteByte(c)
+	}
+	return "", fmt.Errorf("unterminated single quote")
+}
+
+func (p *parser) doubleQuoted() (string, error) {
+	p.next()
+	var b strings.Builder
+	for !p.eof() {
+		c := p.next()
+		switch {
+		case c == '"':
+			return b.String(), nil
+		case c == '\\' && !p.eof():
+			switch e := p.next(); e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(e)
+			default:
+				// Unknown escapes are kept as written
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated double quote")
+}
+
+// Quote returns s as a double-quoted dotenv value. Newlines, tabs, quotes and
+// backslashes are escaped, and so is $, so the value is never expanded.
+func Quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '"', '\\', '$':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
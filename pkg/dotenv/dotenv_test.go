@@ -0,0 +1,79 @@
+package dotenv
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Entry
+	}{
+		{"empty", "", nil},
+		{"comments and blank lines", "# a\n\n  # b\n\t\n", nil},
+		{"plain", "A=1\nB=two words\n", []Entry{{"A", "1", 1}, {"B", "two words", 2}}},
+		{"spaces around =", "A = 1  \n", []Entry{{"A", "1", 1}}},
+		{"export prefix", "export A=1\nexport  B=2\n", []Entry{{"A", "1", 1}, {"B", "2", 2}}},
+		{"key named export", "export=1\n", []Entry{{"export", "1", 1}}},
+		{"empty value", "A=\nB=\n", []Entry{{"A", "", 1}, {"B", "", 2}}},
+		{"inline comment", "A=1 # one\nB=2\t# two\n", []Entry{{"A", "1", 1}, {"B", "2", 2}}},
+		{"comment instead of value", "A= # none\nB=#none\n", []Entry{{"A", "", 1}, {"B", "", 2}}},
+		{"hash inside value", "A=a#b\n", []Entry{{"A", "a#b", 1}}},
+		{"unquoted keeps references", "A=${B}/x $C\n", []Entry{{"A", "${B}/x $C", 1}}},
+		{"double quoted escapes", `A="a\nb\tc\"d\\e\$f\x"`, []Entry{{"A", "a\nb\tc\"d\\e$f\\x", 1}}},
+		{"double quoted keeps references", `A="${B} # not a comment"`, []Entry{{"A", "${B} # not a comment", 1}}},
+		{"single quoted is literal", `A='a\n "b" $C ${D}'`, []Entry{{"A", `a\n "b" $C ${D}`, 1}}},
+		{"comment after quotes", "A=\"1\" # one\nB='2'\n", []Entry{{"A", "1", 1}, {"B", "2", 2}}},
+		{"multiline quotes", "A=\"l1\nl2\"\nB='l3\nl4'\nC=5\n", []Entry{{"A", "l1\nl2", 1}, {"B", "l3\nl4", 3}, {"C", "5", 5}}},
+		{"crlf", "A=1\r\nB=\"2\"\r\n", []Entry{{"A", "1", 1}, {"B", "2", 2}}},
+		{"repeated key", "A=1\nA=2\n", []Entry{{"A", "1", 1}, {"A", "2", 2}}},
+		{"no trailing newline", "A=1", []Entry{{"A", "1", 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"missing =", "A=1\nB\n", "line 2: expected = after B"},
+		{"missing key", "=1\n", "line 1: expected KEY=VALUE"},
+		{"unterminated double quote", "A=1\nB=\"x\ny\n", "line 2: unterminated double quote"},
+		{"unterminated single quote", "A='x\n", "line 1: unterminated single quote"},
+		{"junk after quotes", "A=\"x\"y\n", "line 1: unexpected characters after quoted value of A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.in))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Parse error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, s := range []string{"", "plain", "a b", "l1\nl2\r\n", "tab\t", `q"uo'te`, `back\slash`, "$HOME ${X} $$"} {
+		got, err := Parse([]byte("A=" + Quote(s)))
+		if err != nil {
+			t.Fatalf("Parse(Quote(%q)): %v", s, err)
+		}
+		if len(got) != 1 || got[0].Value != s {
+			t.Errorf("Parse(Quote(%q)) = %q", s, got)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package memevault loads secrets from a memevault vault into the process
+// environment, in the style of godotenv. Call Load at startup instead of
+// wrapping a long-lived process in `memevault run`:
+//
+//	if err := memevault.Load(); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// The identity is resolved like the CLI does: MEMEVAULT_IDENTITY (a raw
+// AGE-SECRET-KEY), then MEMEVAULT_KEY_FILE, then ~/.memevault/keys/memevault.key.
+// MEMEVAULT_ENV selects the environment to load.
+//
+// Vault signatures are checked strictly (see Verify): a program never starts
+// with secrets from an unsigned vault or one written by a signer the reader
+// doesn't trust, since nobody would see a warning.
+package memevault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
+)
+
+// DefaultVault is the vault file looked for when no path is given.
+const DefaultVault = "secrets.jpg"
+
+// EnvVault overrides the vault path used when no path is given.
+const EnvVault = "MEMEVAULT_VAULT"
+
+// Verify is how vault signatures are checked. With the default,
+// vault.VerifyStrict, unsigned vaults and untrusted signers are errors
+// (vault.ErrUnsigned, vault.ErrUntrustedSigner); vault.VerifyWarn accepts
+// them silently.
+var Verify = vault.VerifyStrict
+
+// Load decrypts the given vaults (or the default one) and sets each secret
+// in the process environment. Variables that are already set are left alone.
+func Load(vaults ...string) error {
+	return load(false, vaults)
+}
+
+// Overload is like Load, but replaces variables that are already set.
+func Overload(vaults ...string) error {
+	return load(true, vaults)
+}
+
+// Read decrypts the given vaults (or the default one) and returns their
+// secrets without touching the environment. Later vaults take precedence.
+// Binary secrets are left out, since they can't be environment variables, as
+// are templates referencing keys that don't exist.
+func Read(vaults ...string) (map[string]string, error) {
+	paths, err := vaultPaths(vaults)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := vault.LoadIdentity("")
+	if err != nil {
+		return nil, err
+	}
+
+	opts := vault.DefaultOptions()
+	opts.Verify = Verify
+	opts.Env = os.Getenv(vault.EnvName)
+	if key := os.Getenv(vault.EnvStegoKey); key != "" {
+		opts.StegoKey = []byte(key)
+	}
+
+	env := make(map[string]string)
+	for _, path := range paths {
+		v, err := vault.OpenWithOptions(path, identity, opts)
+		if errors.Is(err, vault.ErrUnsigned) || errors.Is(err, vault.ErrUntrustedSigner) {
+			return nil, fmt.Errorf("%s: %w; check it with 'memevault access list' and save or trust it with the CLI", path, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Templates that can't be expanded are left out like invalid keys, so
+		// unsetting a key they reference doesn't stop the program starting
+		secrets, err := v.Expanded()
+		var broken *vault.TemplateError
+		if err != nil && !errors.As(err, &broken) {
+			return nil, err
+		}
+		for _, k := range secrets.Keys() {
+			// Same rules as `memevault run`: never inject names a shell couldn't
+			// use, or binary values no environment variable can hold
+			if !vault.ValidKey(k) || vault.TypeOf(secrets[k]) == vault.TypeBinary {
+				continue
+			}
+			env[k] = secrets[k]
+		}
+	}
+	return env, nil
+}
+
+func load(override bool, vaults []string) error {
+	env, err := Read(vaults...)
+	if err != nil {
+		return err
+	}
+
+	for k, val := range env {
+		if _, exists := os.LookupEnv(k); exists && !override {
+			continue
+		}
+		if err := os.Setenv(k, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vaultPaths returns the explicit paths, MEMEVAULT_VAULT, or the default
+// vault found in the working directory or one of its parents.
+func vaultPaths(vaults []string) ([]string, error) {
+	if len(vaults) > 0 {
+		return vaults, nil
+	}
+	if path := os.Getenv(EnvVault); path != "" {
+		return []string{path}, nil
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		path := filepath.Join(dir, DefaultVault)
+		if _, err := os.Stat(path); err == nil {
+			return []string{path}, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.New("no " + DefaultVault + " found in the working directory or its parents")
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,61 @@
+package memevault
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/thoughtlesslabs/memevault/pkg/vault"
+)
+
+// testVault writes a vault holding secrets to a temporary directory, signed
+// by the identity in MEMEVAULT_IDENTITY unless unsigned is set.
+func testVault(t *testing.T, secrets map[string]string, unsigned bool) string {
+	t.Helper()
+	identity, publicKey, err := vault.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(vault.EnvIdentity, identity)
+	t.Setenv(vault.EnvName, "")
+
+	path := filepath.Join(t.TempDir(), "secrets.bin")
+	v := vault.New(path, []vault.Recipient{{Name: "me", PublicKey: publicKey}})
+	if !unsigned {
+		v.SignWith(identity)
+	}
+	for k, val := range secrets {
+		if err := v.Set(k, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRead(t *testing.T) {
+	path := testVault(t, map[string]string{"API_KEY": "secret", "CERT": "\x00\xff"}, false)
+	env, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(env) != 1 || env["API_KEY"] != "secret" {
+		t.Errorf("Read = %q, want only API_KEY (binary values are left out)", env)
+	}
+}
+
+func TestReadVerify(t *testing.T) {
+	path := testVault(t, map[string]string{"API_KEY": "secret"}, true)
+	if _, err := Read(path); !errors.Is(err, vault.ErrUnsigned) {
+		t.Errorf("Read of an unsigned vault: %v, want %v", err, vault.ErrUnsigned)
+	}
+
+	defer func(mode vault.VerifyMode) { Verify = mode }(Verify)
+	Verify = vault.VerifyWarn
+	if env, err := Read(path); err != nil || env["API_KEY"] != "secret" {
+		t.Errorf("Read with VerifyWarn = %q, %v", env, err)
+	}
+}
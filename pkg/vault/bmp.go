@@ -0,0 +1,112 @@
+package vault
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// bmpContainer appends the payload after the bitmap like other images, or
+// hides it in the pixel data with StegoLSB. Only uncompressed 24 and 32 bit
+// bitmaps are supported for LSB, since their bytes map directly to channels.
+type bmpContainer struct {
+	opts Options
+}
+
+func (bmpContainer) Name() string { return "bmp" }
+
+func (c bmpContainer) Extract(data []byte) ([]byte, error) {
+	if blob, err := (trailerContainer{}).Extract(data); err == nil {
+		return blob, nil
+	}
+
+	carrier, err := c.carrier(data)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := carrier.read(c.opts.StegoKey)
+	if err != nil {
+		return nil, errors.New("no memevault payload found in BMP")
+	}
+	return blob, nil
+}
+
+func (c bmpContainer) Embed(data, blob []byte) ([]byte, error) {
+	data = stripTrailer(data)
+
+	// The carrier works on a copy, so the original bytes are never modified
+	carrier, err := c.carrier(append([]byte(nil), data...))
+	lsb := c.opts.Stego == StegoLSB
+	if c.opts.Stego == StegoAuto && err == nil {
+		_, readErr := carrier.read(c.opts.StegoKey)
+		lsb = readErr == nil
+	}
+	if !lsb {
+		if err == nil {
+			// Don't leave the old payload in the pixels when leaving LSB mode
+			if found, err := carrier.scrub(c.opts.StegoKey); err != nil {
+				return nil, err
+			} else if found {
+				data = carrier.buf
+			}
+		}
+		return trailerContainer{}.Embed(data, blob)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if err := carrier.write(c.opts.StegoKey, blob); err != nil {
+		return nil, err
+	}
+	return carrier.buf, nil
+}
+
+func (bmpContainer) carrier(data []byte) (*lsbCarrier, error) {
+	if len(data) < 54 {
+		return nil, errors.New("truncated BMP header")
+	}
+
+	pixelOffset := int(binary.LittleEndian.Uint32(data[10:14]))
+	headerSize := binary.LittleEndian.Uint32(data[14:18])
+	if headerSize < 40 {
+		return nil, errors.New("unsupported BMP header (OS/2 bitmaps are not supported)")
+	}
+	width := int(int32(binary.LittleEndian.Uint32(data[18:22])))
+	height := int(int32(binary.LittleEndian.Uint32(data[22:26])))
+	bpp := int(binary.LittleEndian.Uint16(data[28:30]))
+	compression := binary.LittleEndian.Uint32(data[30:34])
+
+	if height < 0 {
+		// Top-down bitmap; row order doesn't matter to us
+		height = -height
+	}
+	if bpp != 24 && bpp != 32 {
+		return nil, fmt.Errorf("LSB steganography needs a 24 or 32 bit BMP, not %d bit", bpp)
+	}
+	// BI_RGB, or BI_BITFIELDS which 32 bit bitmaps use for plain BGRA
+	if compression != 0 && !(compression == 3 && bpp == 32) {
+		return nil, errors.New("LSB steganography needs an uncompressed BMP")
+	}
+
+	// The header is untrusted input, so every bound is checked without
+	// multiplying values that could overflow
+	bytesPerPixel := bpp / 8
+	if pixelOffset < 0 || pixelOffset >= len(data) || width <= 0 || width > len(data)/bytesPerPixel || height <= 0 {
+		return nil, errors.New("invalid BMP dimensions")
+	}
+	// Rows are padded to 4 bytes
+	stride := (width*bytesPerPixel + 3) &^ 3
+	if height > (len(data)-pixelOffset)/stride {
+		return nil, errors.New("invalid BMP dimensions")
+	}
+
+	return &lsbCarrier{
+		buf:      data,
+		channels: width * height * 3,
+		offset: func(i int) int {
+			p := i / 3
+			return pixelOffset + (p/width)*stride + (p%width)*bytesPerPixel + i%3
+		},
+	}, nil
+}
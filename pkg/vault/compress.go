@@ -0,0 +1,50 @@
+package vault
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compress gzips data. It reports false (and returns data unchanged) when
+// compression doesn't make the payload smaller, as with tiny vaults.
+func Compress(data []byte) ([]byte, bool) {
+	out := &bytes.Buffer{}
+	w, _ := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if _, err := w.Write(data); err != nil {
+		return data, false
+	}
+	if err := w.Close(); err != nil {
+		return data, false
+	}
+
+	if out.Len() >= len(data) {
+		return data, false
+	}
+	return out.Bytes(), true
+}
+
+// maxDecompressedSize caps what Decompress inflates a payload to, so a small
+// crafted vault can't exhaust memory. Real vaults are far smaller. It is a
+// variable so tests can lower it.
+var maxDecompressedSize = 256 << 20
+
+// Decompress reverses Compress. Payloads inflating to more than 256 MiB are
+// rejected.
+func Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, int64(maxDecompressedSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxDecompressedSize {
+		return nil, fmt.Errorf("decompressed payload exceeds %d MiB", maxDecompressedSize>>20)
+	}
+	return out, nil
+}
@@ -0,0 +1,48 @@
+package vault
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"API_KEY":"12345"}`), 100)
+	compressed, ok := Compress(data)
+	if !ok || len(compressed) >= len(data) {
+		t.Fatalf("Compress = %d bytes, %v; want fewer than %d", len(compressed), ok, len(data))
+	}
+	got, err := Decompress(compressed)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Decompress = %d bytes, %v; want the original %d", len(got), err, len(data))
+	}
+
+	if out, ok := Compress([]byte("x")); ok || string(out) != "x" {
+		t.Errorf("Compress of a tiny payload = %q, %v; want it unchanged", out, ok)
+	}
+	if _, err := Decompress([]byte("not gzip")); err == nil {
+		t.Error("Decompress accepted data that isn't gzip")
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	defer func(max int) { maxDecompressedSize = max }(maxDecompressedSize)
+	maxDecompressedSize = 1 << 10
+
+	for size, wantErr := range map[int]bool{1 << 10: false, 1<<10 + 1: true} {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(make([]byte, size))
+		w.Close()
+
+		got, err := Decompress(buf.Bytes())
+		if wantErr {
+			if err == nil || !strings.Contains(err.Error(), "decompressed payload exceeds") {
+				t.Errorf("Decompress of %d bytes = %v, want an error", size, err)
+			}
+		} else if err != nil || len(got) != size {
+			t.Errorf("Decompress of %d bytes = %d bytes, %v", size, len(got), err)
+		}
+	}
+}
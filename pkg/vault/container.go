@@ -0,0 +1,152 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age/armor"
+)
+
+// Container knows how to hide a payload blob (an encoded Frame) inside a
+// particular file format.
+type Container interface {
+	// Name is a short identifier for the format, e.g. "jpeg".
+	Name() string
+	// Extract returns the payload blob embedded in the file contents.
+	Extract(data []byte) ([]byte, error)
+	// Embed returns the file contents with blob embedded, replacing any
+	// payload that was already there.
+	Embed(data, blob []byte) ([]byte, error)
+}
+
+var (
+	jpegMagic    = []byte{0xFF, 0xD8, 0xFF}
+	pngMagic     = []byte("\x89PNG\r\n\x1a\n")
+	gif87Magic   = []byte("GIF87a")
+	gif89Magic   = []byte("GIF89a")
+	bmpMagic     = []byte("BM")
+	ageMagic     = []byte("age-encryption.org/")
+	ageArmorHead = []byte(armor.Header)
+)
+
+// DetectContainer picks the container for the given file contents by looking
+// at their magic bytes. Empty contents are treated as a new raw vault.
+func DetectContainer(data []byte, opts Options) (Container, error) {
+	switch {
+	case bytes.HasPrefix(data, jpegMagic):
+		return jpegContainer{}, nil
+	case bytes.HasPrefix(data, pngMagic):
+		return pngContainer{opts: opts}, nil
+	case bytes.HasPrefix(data, bmpMagic) && len(data) >= 26:
+		return bmpContainer{opts: opts}, nil
+	case bytes.HasPrefix(data, gif87Magic), bytes.HasPrefix(data, gif89Magic):
+		return trailerContainer{name: "gif"}, nil
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return trailerContainer{name: "webp"}, nil
+	case len(data) == 0, IsFrame(data), bytes.HasPrefix(data, ageMagic), bytes.HasPrefix(bytes.TrimSpace(data), ageArmorHead):
+		return rawContainer{}, nil
+	}
+
+	// Unknown format that already carries a payload (e.g. an image type we
+	// don't sniff yet): keep treating it as a trailer container.
+	if _, _, err := locateTrailer(data); err == nil {
+		return trailerContainer{name: "unknown"}, nil
+	}
+
+	return nil, errors.New("unrecognized vault container format (expected JPEG, PNG, GIF, WebP, BMP or a raw age/memevault file)")
+}
+
+// ReadFrame reads the vault file at path, detects its container and returns
+// the decoded frame.
+func ReadFrame(path string, opts Options) (*Frame, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := DetectContainer(data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := c.Extract(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s container: %v", c.Name(), err)
+	}
+
+	return DecodeFrame(blob)
+}
+
+// WriteFrame stores the frame in the vault file at path, keeping the existing
+// container (image) intact. A missing file is created as a raw vault.
+// The file is replaced atomically, so a crash never leaves it without a payload.
+func WriteFrame(path string, frame *Frame, opts Options) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	c, err := DetectContainer(data, opts)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.(lsbCapable); opts.Stego == StegoLSB && !ok {
+		return fmt.Errorf("LSB steganography needs a lossless PNG or BMP image, not %s", c.Name())
+	}
+
+	out, err := c.Embed(data, EncodeFrame(frame))
+	if err != nil {
+		return fmt.Errorf("%s container: %v", c.Name(), err)
+	}
+
+	return WriteFileAtomic(path, out, 0644)
+}
+
+// rawContainer is a file that holds nothing but the payload: either a
+// memevault frame or a legacy binary/armored age ciphertext.
+type rawContainer struct{}
+
+func (rawContainer) Name() string { return "raw" }
+
+func (rawContainer) Extract(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("vault file is empty")
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), ageArmorHead) {
+		return data, nil
+	}
+
+	// Legacy armored ciphertext: hand the binary form to the decoder
+	out, err := io.ReadAll(armor.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age armor: %v", err)
+	}
+	return out, nil
+}
+
+func (rawContainer) Embed(_, blob []byte) ([]byte, error) {
+	return blob, nil
+}
+
+// trailerContainer appends the payload after the end of an image.
+// Format: [Original Image Bytes] [Payload] [Payload Length (8 bytes)] [Magic Bytes]
+type trailerContainer struct {
+	name string
+}
+
+func (c trailerContainer) Name() string { return c.name }
+
+func (trailerContainer) Extract(data []byte) ([]byte, error) {
+	start, end, err := locateTrailer(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[start:end], nil
+}
+
+func (trailerContainer) Embed(data, blob []byte) ([]byte, error) {
+	return appendTrailer(stripTrailer(data), blob), nil
+}
@@ -0,0 +1,250 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testImage returns a w x h image with varied pixels.
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 7), G: uint8(y * 13), B: uint8(x + y), A: 0xFF})
+		}
+	}
+	return img
+}
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(w, h), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testJFIF returns a JPEG with a JFIF (APP0) segment after SOI.
+func testJFIF(t *testing.T, w, h int) []byte {
+	t.Helper()
+	data := testJPEG(t, w, h)
+	app0 := []byte{0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0, 1, 1, 0, 0, 1, 0, 1, 0, 0}
+	return append(append(append([]byte(nil), data[:2]...), app0...), data[2:]...)
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testGIF(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, testImage(8, 8), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testBMP returns an uncompressed bottom-up bitmap with bpp bits per pixel.
+func testBMP(w, h, bpp int) []byte {
+	stride := (w*bpp + 31) / 32 * 4
+	data := make([]byte, 54+stride*h)
+	copy(data, "BM")
+	binary.LittleEndian.PutUint32(data[2:6], uint32(len(data)))
+	binary.LittleEndian.PutUint32(data[10:14], 54)
+	binary.LittleEndian.PutUint32(data[14:18], 40)
+	binary.LittleEndian.PutUint32(data[18:22], uint32(w))
+	binary.LittleEndian.PutUint32(data[22:26], uint32(h))
+	binary.LittleEndian.PutUint16(data[26:28], 1)
+	binary.LittleEndian.PutUint16(data[28:30], uint16(bpp))
+	for i := 54; i < len(data); i++ {
+		data[i] = byte(i * 31)
+	}
+	return data
+}
+
+func testWebP() []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")
+	return append(data, bytes.Repeat([]byte{0x2A}, 32)...)
+}
+
+// testBlob returns an encoded frame with a size byte payload.
+func testBlob(size int, fill byte) []byte {
+	return EncodeFrame(NewFrame(KindSecrets, FlagEncrypted, bytes.Repeat([]byte{fill}, size)))
+}
+
+func TestDetectContainer(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"jpeg", testJPEG(t, 8, 8), "jpeg"},
+		{"png", testPNG(t, 8, 8), "png"},
+		{"bmp", testBMP(8, 8, 24), "bmp"},
+		{"gif", testGIF(t), "gif"},
+		{"webp", testWebP(), "webp"},
+		{"new file", nil, "raw"},
+		{"frame", testBlob(4, 1), "raw"},
+		{"binary age", []byte("age-encryption.org/v1\n"), "raw"},
+		{"armored age", []byte("\n-----BEGIN AGE ENCRYPTED FILE-----\n"), "raw"},
+		{"unknown with trailer", appendTrailer([]byte("some other format"), testBlob(4, 1)), "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := DetectContainer(tt.data, Options{})
+			if err != nil {
+				t.Fatalf("DetectContainer: %v", err)
+			}
+			if c.Name() != tt.want {
+				t.Errorf("DetectContainer = %s, want %s", c.Name(), tt.want)
+			}
+		})
+	}
+
+	if _, err := DetectContainer([]byte("just some text"), Options{}); err == nil {
+		t.Error("DetectContainer accepted an unrecognized file")
+	}
+}
+
+// testRoundTrip embeds two payloads of size bytes in turn into data and
+// checks each can be extracted, and that the second replaced the first.
+func testRoundTrip(t *testing.T, data []byte, size int) {
+	t.Helper()
+	c, err := DetectContainer(data, Options{})
+	if err != nil {
+		t.Fatalf("DetectContainer: %v", err)
+	}
+
+	first := testBlob(size, 1)
+	out, err := c.Embed(data, first)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if c2, err := DetectContainer(out, Options{}); err != nil || c2.Name() != c.Name() {
+		t.Fatalf("embedding changed the container to %v (%v)", c2, err)
+	}
+	got, err := c.Extract(out)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if !bytes.Equal(got, first) {
+		t.Fatalf("Extract returned %d bytes, want the %d embedded", len(got), len(first))
+	}
+
+	// Saving again replaces the payload instead of adding another
+	second := testBlob(size, 2)
+	again, err := c.Embed(out, second)
+	if err != nil {
+		t.Fatalf("second Embed: %v", err)
+	}
+	if len(again) != len(out) {
+		t.Errorf("second Embed of a same size payload grew the file from %d to %d bytes", len(out), len(again))
+	}
+	if got, err = c.Extract(again); err != nil || !bytes.Equal(got, second) {
+		t.Errorf("Extract after second Embed = %d bytes, %v; want the second payload", len(got), err)
+	}
+}
+
+// testTrailerMigration checks that a payload appended after the image by
+// older releases is read, and moved to where native finds it on the next
+// save.
+func testTrailerMigration(t *testing.T, data []byte, native func(out []byte) bool) {
+	t.Helper()
+	legacy := appendTrailer(data, testBlob(10, 1))
+	c, err := DetectContainer(legacy, Options{})
+	if err != nil {
+		t.Fatalf("DetectContainer: %v", err)
+	}
+	got, err := c.Extract(legacy)
+	if err != nil || !bytes.Equal(got, testBlob(10, 1)) {
+		t.Fatalf("Extract of legacy vault = %x, %v", got, err)
+	}
+
+	out, err := c.Embed(legacy, testBlob(10, 2))
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if _, _, err := locateTrailer(out); err == nil {
+		t.Error("legacy trailer is still there after saving")
+	}
+	if !native(out) {
+		t.Error("payload wasn't moved into the image")
+	}
+	if got, err := c.Extract(out); err != nil || !bytes.Equal(got, testBlob(10, 2)) {
+		t.Errorf("Extract after migration = %x, %v", got, err)
+	}
+}
+
+func TestContainerRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"bmp", testBMP(16, 16, 24)},
+		{"gif", testGIF(t)},
+		{"webp", testWebP()},
+		{"raw", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testRoundTrip(t, tt.data, 100)
+		})
+	}
+}
+
+func TestWriteReadFrame(t *testing.T) {
+	dir := t.TempDir()
+	jpg := filepath.Join(dir, "secrets.jpg")
+	if err := os.WriteFile(jpg, testJPEG(t, 16, 16), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"new raw file", filepath.Join(dir, "prod.bin")},
+		{"existing jpeg", jpg},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := NewFrame(KindSecrets, FlagEncrypted|FlagPadded, []byte("ciphertext"))
+			if err := WriteFrame(tt.path, frame, Options{}); err != nil {
+				t.Fatalf("WriteFrame: %v", err)
+			}
+			got, err := ReadFrame(tt.path, Options{})
+			if err != nil {
+				t.Fatalf("ReadFrame: %v", err)
+			}
+			if got.Flags != frame.Flags || !bytes.Equal(got.Payload, frame.Payload) {
+				t.Errorf("ReadFrame = %+v, want %+v", got, frame)
+			}
+		})
+	}
+
+	text := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(text, []byte("not a vault"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFrame(text, NewFrame(KindSecrets, FlagEncrypted, []byte("x")), Options{}); err == nil {
+		t.Error("WriteFrame overwrote an unrecognized file")
+	}
+	if data, _ := os.ReadFile(text); string(data) != "not a vault" {
+		t.Errorf("unrecognized file was modified: %q", data)
+	}
+}
@@ -2,12 +2,15 @@ package vault
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"filippo.io/age"
+	"filippo.io/age/agessh"
 )
 
 // GenerateKey creates a new X25519 identity and its corresponding public key.
@@ -20,11 +23,54 @@ func GenerateKey() (string, string, error) {
 	return id.String(), id.Recipient().String(), nil
 }
 
+// ParseRecipient parses an age public key (age1...) or an SSH public key
+// (ssh-ed25519 or ssh-rsa).
+func ParseRecipient(s string) (age.Recipient, error) {
+	if isSSHKey(s) {
+		return agessh.ParseRecipient(strings.TrimSpace(s))
+	}
+	return age.ParseX25519Recipient(s)
+}
+
+// ParseIdentity parses an age identity (AGE-SECRET-KEY-1...) or a PEM encoded
+// SSH private key.
+func ParseIdentity(s string) (age.Identity, error) {
+	if isSSHIdentity(s) {
+		return parseSSHIdentity([]byte(s))
+	}
+	return age.ParseX25519Identity(strings.TrimSpace(s))
+}
+
+// SplitIdentities splits an identity string holding several keys (one age
+// identity per line and/or PEM encoded SSH keys) into single identities.
+// Comments and blank lines are dropped.
+func SplitIdentities(s string) []string {
+	var ids []string
+	var pem []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case pem != nil:
+			pem = append(pem, line)
+			if strings.HasPrefix(line, "-----END ") {
+				ids = append(ids, strings.Join(pem, "\n"))
+				pem = nil
+			}
+		case strings.HasPrefix(line, "-----BEGIN "):
+			pem = []string{line}
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			ids = append(ids, line)
+		}
+	}
+	return ids
+}
+
 // Encrypt encrypts the given data for the list of recipients.
 func Encrypt(data []byte, recipients []string) ([]byte, error) {
 	var parsedRecipients []age.Recipient
 	for _, r := range recipients {
-		pubKey, err := age.ParseX25519Recipient(r)
+		pubKey, err := ParseRecipient(r)
 		if err != nil {
 			return nil, fmt.Errorf("invalid recipient %q: %v", r, err)
 		}
@@ -46,44 +92,158 @@ func Encrypt(data []byte, recipients []string) ([]byte, error) {
 	return out.Bytes(), nil
 }
 
-// Decrypt decrypts the given data using the provided identity (private key).
-// We try to parse the identity string as an X25519 identity.
+// Decrypt decrypts the given data using the provided identity (private key),
+// either an age X25519 identity or an SSH private key. identityStr may hold
+// several identities (see SplitIdentities); each one is tried.
 func Decrypt(data []byte, identityStr string) ([]byte, error) {
-	identity, err := age.ParseX25519Identity(identityStr)
-	if err != nil {
-		// Try parsing as legacy if needed, or handle file paths?
-		// For now assume direct string from key file
-		return nil, fmt.Errorf("invalid identity: %v", err)
+	out, _, err := DecryptMatch(data, identityStr)
+	return out, err
+}
+
+// DecryptMatch is like Decrypt, and also returns the identity that matched.
+func DecryptMatch(data []byte, identityStr string) ([]byte, string, error) {
+	split := SplitIdentities(identityStr)
+	if len(split) == 0 {
+		return nil, "", errors.New("invalid identity: no identity given")
 	}
 
-	r, err := age.Decrypt(bytes.NewReader(data), identity)
+	matched := -1
+	identities := make([]age.Identity, len(split))
+	for i, s := range split {
+		id, err := ParseIdentity(s)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid identity: %v", err)
+		}
+		identities[i] = matchIdentity{id, i, &matched}
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), identities...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	out := &bytes.Buffer{}
 	if _, err := io.Copy(out, r); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return out.Bytes(), nil
+	return out.Bytes(), split[matched], nil
 }
 
-// LoadIdentityFromFile reads an identity key from a file.
-// It skips comments and empty lines, returning the first valid identity found.
+// matchIdentity records which of several identities unwrapped the file key.
+type matchIdentity struct {
+	age.Identity
+	index   int
+	matched *int
+}
+
+func (m matchIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	fileKey, err := m.Identity.Unwrap(stanzas)
+	if err == nil {
+		*m.matched = m.index
+	}
+	return fileKey, err
+}
+
+// Environment variables consulted when no key file is given explicitly.
+const (
+	// EnvIdentity holds a raw AGE-SECRET-KEY identity.
+	EnvIdentity = "MEMEVAULT_IDENTITY"
+	// EnvKeyFile holds the path to an identity file.
+	EnvKeyFile = "MEMEVAULT_KEY_FILE"
+	// EnvStegoKey holds the key used for StegoLSB pixel ordering.
+	EnvStegoKey = "MEMEVAULT_STEGO_KEY"
+)
+
+// DefaultKeyFile returns the standard identity location, ~/.memevault/keys/memevault.key.
+func DefaultKeyFile() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".memevault", "keys", "memevault.key")
+}
+
+// ResolveKeyFile returns the identity file LoadIdentity reads for keyFile,
+// or "" when the identity comes from MEMEVAULT_IDENTITY instead.
+func ResolveKeyFile(keyFile string) string {
+	switch {
+	case keyFile != "":
+		return keyFile
+	case strings.TrimSpace(os.Getenv(EnvIdentity)) != "":
+		return ""
+	case os.Getenv(EnvKeyFile) != "":
+		return os.Getenv(EnvKeyFile)
+	}
+	return DefaultKeyFile()
+}
+
+// LoadIdentity resolves the identity to decrypt with. An explicit keyFile
+// wins; otherwise MEMEVAULT_IDENTITY, then MEMEVAULT_KEY_FILE, then the
+// default key file are used.
+func LoadIdentity(keyFile string) (string, error) {
+	path := ResolveKeyFile(keyFile)
+	if path == "" {
+		return strings.TrimSpace(os.Getenv(EnvIdentity)), nil
+	}
+	return LoadIdentityFromFile(path)
+}
+
+// IdentityRecipients returns the public keys of every identity in identity.
+func IdentityRecipients(identity string) ([]string, error) {
+	var keys []string
+	for _, id := range SplitIdentities(identity) {
+		key, err := IdentityRecipient(id)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// IdentityRecipient returns the public key (recipient) for a single identity.
+func IdentityRecipient(identity string) (string, error) {
+	if isSSHIdentity(identity) {
+		return sshIdentityRecipient([]byte(identity))
+	}
+	id, err := age.ParseX25519Identity(strings.TrimSpace(identity))
+	if err != nil {
+		return "", fmt.Errorf("invalid identity: %v", err)
+	}
+	return id.Recipient().String(), nil
+}
+
+// LoadIdentityFromFile reads the identities in a key file, skipping comments
+// and empty lines. A file may hold several age identities (one per line) and
+// SSH private keys. Passphrase protected files are decrypted using
+// PassphrasePrompt.
 func LoadIdentityFromFile(path string) (string, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
+	return parseIdentityFile(content, path)
+}
 
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+// LoadIdentityFromReader is like LoadIdentityFromFile, for identities piped
+// in on stdin and the like.
+func LoadIdentityFromReader(r io.Reader) (string, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return parseIdentityFile(content, "input")
+}
+
+func parseIdentityFile(content []byte, source string) (string, error) {
+	if IsProtectedIdentity(content) {
+		var err error
+		if content, err = unprotectIdentity(content, source); err != nil {
+			return "", err
 		}
-		return line, nil
 	}
-	return "", fmt.Errorf("no identity found in %s", path)
+
+	ids := SplitIdentities(string(content))
+	if len(ids) == 0 {
+		return "", fmt.Errorf("no identity found in %s", source)
+	}
+	return strings.Join(ids, "\n"), nil
 }
@@ -0,0 +1,287 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// DefaultEnv is the environment a flat (single environment) vault holds, and
+// the one opened when Options.Env is empty.
+const DefaultEnv = "default"
+
+// EnvName is the environment variable that selects an environment when none
+// is given explicitly.
+const EnvName = "MEMEVAULT_ENV"
+
+var validEnv = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ValidEnv reports whether name is usable as an environment name.
+func ValidEnv(name string) bool {
+	return validEnv.MatchString(name)
+}
+
+// decodeEnvs returns the encoded secrets frame of every environment in a
+// vault frame. Flat vaults hold a single DefaultEnv environment.
+func decodeEnvs(frame *Frame) (map[string][]byte, error) {
+	if frame.Kind != KindBundle {
+		return map[string][]byte{DefaultEnv: EncodeFrame(frame)}, nil
+	}
+
+	var envs map[string][]byte
+	if err := json.Unmarshal(frame.Payload, &envs); err != nil {
+		return nil, fmt.Errorf("invalid environment bundle: %v", err)
+	}
+	if len(envs) == 0 {
+		return nil, fmt.Errorf("invalid environment bundle: no environments")
+	}
+	return envs, nil
+}
+
+// encodeEnvs builds the vault frame for a set of encoded environments. A
+// vault holding only DefaultEnv is written flat, so older releases can read it.
+func encodeEnvs(envs map[string][]byte) (*Frame, error) {
+	if data, ok := envs[DefaultEnv]; ok && len(envs) == 1 {
+		return DecodeFrame(data)
+	}
+	payload, err := json.Marshal(envs)
+	if err != nil {
+		return nil, err
+	}
+	return NewFrame(KindBundle, 0, payload), nil
+}
+
+// sortedEnvs returns the environment names in sorted order.
+func sortedEnvs(envs map[string][]byte) []string {
+	names := make([]string, 0, len(envs))
+	for name := range envs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ListEnvs returns the environments in the vault at path. Environment names
+// are not encrypted, so no identity is needed.
+func ListEnvs(path string, opts Options) ([]string, error) {
+	frame, err := ReadFrame(path, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault file: %v", err)
+	}
+	envs, err := decodeEnvs(frame)
+	if err != nil {
+		return nil, err
+	}
+	return sortedEnvs(envs), nil
+}
+
+// Env returns the name of the opened environment.
+func (v *Vault) Env() string {
+	return v.env
+}
+
+// Envs returns the names of all environments in the vault.
+func (v *Vault) Envs() []string {
+	envs := map[string][]byte{v.env: nil}
+	for name, data := range v.others {
+		envs[name] = data
+	}
+	return sortedEnvs(envs)
+}
+
+// CreateEnv adds an empty environment and switches the vault to it. The new
+// environment starts with the current environment's recipients, but no parent
+// (see SetParent); the current one is kept as it is. Nothing is written until
+// Save.
+func (v *Vault) CreateEnv(name string) error {
+	if !ValidEnv(name) {
+		return fmt.Errorf("invalid environment name '%s'; names must match [a-zA-Z0-9][a-zA-Z0-9_.-]*", name)
+	}
+	if _, ok := v.others[name]; ok || name == v.env {
+		return fmt.Errorf("environment '%s' already exists", name)
+	}
+
+	frame, err := v.encode()
+	if err != nil {
+		return err
+	}
+	v.others[v.env] = EncodeFrame(frame)
+
+	// Everything read from the current environment stays with it
+	v.env = name
+	v.parent = ""
+	v.signedBy, v.verifyErr = Recipient{}, nil
+	v.pins, v.newlyTrusted, v.pinErr = nil, nil, nil
+	v.secrets = SecretsMap{}
+	v.templates = map[string]bool{}
+	v.recipients = append([]Recipient(nil), v.recipients...)
+	return nil
+}
+
+// envData returns the encoded frame of the named environment.
+func envData(envs map[string][]byte, env string) ([]byte, error) {
+	data, ok := envs[env]
+	if !ok {
+		return nil, fmt.Errorf("environment '%s' does not exist (available: %s)", env, strings.Join(sortedEnvs(envs), ", "))
+	}
+	return data, nil
+}
+
+// ParentKey stores the name of the environment an environment inherits from.
+const ParentKey = ReservedPrefix + "parent"
+
+// Layer is one environment in an inheritance chain.
+type Layer struct {
+	Env     string
+	Secrets SecretsMap
+	// Templates holds the keys whose values are templates.
+	Templates map[string]bool
+}
+
+// Parent returns the environment the opened environment inherits from, or "".
+func (v *Vault) Parent() string {
+	return v.parent
+}
+
+// SetParent makes the opened environment inherit the secrets of parent that
+// it doesn't set itself. An empty parent removes the inheritance. The parent
+// chain must not loop and must be readable with the vault's identity.
+func (v *Vault) SetParent(parent string) error {
+	if parent == "" {
+		v.parent = ""
+		return nil
+	}
+	if parent == v.env {
+		return fmt.Errorf("environment '%s' can't inherit from itself", parent)
+	}
+	if _, err := envData(v.others, parent); err != nil {
+		return err
+	}
+
+	old := v.parent
+	v.parent = parent
+	if _, err := v.Layers(); err != nil {
+		v.parent = old
+		return err
+	}
+	return nil
+}
+
+// Layers returns the opened environment followed by its ancestors, nearest
+// first. Each ancestor is decrypted (and its signature checked) on demand.
+func (v *Vault) Layers() ([]Layer, error) {
+	layers := []Layer{{Env: v.env, Secrets: maps.Clone(v.secrets), Templates: maps.Clone(v.templates)}}
+	chain := []string{v.env}
+	for parent := v.parent; parent != ""; {
+		if slices.Contains(chain, parent) {
+			return nil, fmt.Errorf("environment inheritance loops: %s -> %s", strings.Join(chain, " -> "), parent)
+		}
+		chain = append(chain, parent)
+
+		data, err := envData(v.others, parent)
+		if err != nil {
+			return nil, fmt.Errorf("parent of '%s': %v", chain[len(chain)-2], err)
+		}
+		p, err := decodeVault(v.path, data, parent, v.identity, v.Options)
+		if err != nil {
+			return nil, fmt.Errorf("parent environment '%s': %v", parent, err)
+		}
+		layers = append(layers, Layer{Env: parent, Secrets: p.secrets, Templates: p.templates})
+		parent = p.parent
+	}
+	return layers, nil
+}
+
+// Resolved returns the secrets visible in the opened environment: its own,
+// plus those inherited from its ancestors that it doesn't override. Templates
+// are returned unexpanded; see Expanded.
+func (v *Vault) Resolved() (SecretsMap, error) {
+	resolved, _, err := v.resolve()
+	return resolved, err
+}
+
+// resolve is Resolved, also returning which of the resolved keys hold
+// templates in the environment they come from.
+func (v *Vault) resolve() (SecretsMap, map[string]bool, error) {
+	layers, err := v.Layers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolved := SecretsMap{}
+	templates := map[string]bool{}
+	for i := len(layers) - 1; i >= 0; i-- {
+		for _, k := range layers[i].Secrets.Keys() {
+			resolved[k] = layers[i].Secrets[k]
+			templates[k] = layers[i].Templates[k]
+		}
+	}
+	return resolved, templates, nil
+}
+
+// ReplaceKey swaps the recipient with public key oldKey for the public key of
+// newIdentity, keeping its name, in every environment the vault's identity
+// can open (adding it where oldKey isn't listed), and makes newIdentity sign
+// them on Save. Environments the identity can't open are left alone, since
+// oldKey can't be one of their recipients. It returns the environments that
+// were changed.
+func (v *Vault) ReplaceKey(oldKey, newIdentity string) ([]string, error) {
+	newKey, err := IdentityRecipient(newIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	others := make(map[string][]byte, len(v.others))
+	changed := []string{v.env}
+	for _, name := range sortedEnvs(v.others) {
+		p, err := decodeVault(v.path, v.others[name], name, v.identity, v.Options)
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			others[name] = v.others[name]
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("environment '%s': %v", name, err)
+		}
+
+		p.recipients = replaceRecipient(p.recipients, oldKey, newKey)
+		p.signer = newIdentity
+		frame, err := p.encode()
+		if err != nil {
+			return nil, fmt.Errorf("environment '%s': %v", name, err)
+		}
+		others[name] = EncodeFrame(frame)
+		changed = append(changed, name)
+	}
+
+	v.recipients = replaceRecipient(v.recipients, oldKey, newKey)
+	v.signer = newIdentity
+	v.others = others
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// replaceRecipient returns recipients with oldKey's entry pointing at newKey,
+// or with newKey added as "rotated-key" if oldKey isn't listed.
+func replaceRecipient(recipients []Recipient, oldKey, newKey string) []Recipient {
+	replaced := make([]Recipient, 0, len(recipients)+1)
+	found := false
+	for _, r := range recipients {
+		if r.PublicKey == oldKey {
+			r = Recipient{Name: r.Name, PublicKey: newKey}
+			found = true
+		}
+		replaced = append(replaced, r)
+	}
+	if !found {
+		replaced = append(replaced, Recipient{Name: "rotated-key", PublicKey: newKey})
+	}
+	return replaced
+}
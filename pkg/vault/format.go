@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// FrameMagic identifies a versioned memevault payload frame.
+var FrameMagic = []byte("MVLT")
+
+// FormatVersion is the newest frame version this build can read and the one it writes.
+const FormatVersion = 1
+
+// frameHeaderSize is the size of the fixed frame header:
+// [Magic (4)] [Version (1)] [Kind (1)] [Flags (2)] [CRC32 (4)] [Payload Length (8)]
+const frameHeaderSize = 4 + 1 + 1 + 2 + 4 + 8
+
+// Kind describes what the frame payload contains once decoded.
+type Kind uint8
+
+const (
+	// KindSecrets is a JSON encoded secrets map.
+	KindSecrets Kind = 1
+	// KindBundle is a JSON object mapping environment names to encoded
+	// KindSecrets frames, each encrypted to its own recipients.
+	KindBundle Kind = 2
+)
+
+// Flags describe how the frame payload was transformed before it was stored.
+// Readers must reject flags they do not understand, since each one changes
+// how the payload has to be decoded.
+type Flags uint16
+
+const (
+	// FlagEncrypted marks the payload as an age (binary format) ciphertext.
+	FlagEncrypted Flags = 1 << iota
+	// FlagPadded marks the plaintext as padded with Pad before encryption.
+	FlagPadded
+	// FlagCompressed marks the plaintext as gzip compressed (before padding).
+	FlagCompressed
+)
+
+// knownFlags is the set of flags this build knows how to decode.
+const knownFlags = FlagEncrypted | FlagPadded | FlagCompressed
+
+// Has reports whether all bits of flag are set.
+func (f Flags) Has(flag Flags) bool {
+	return f&flag == flag
+}
+
+// Frame is a self-describing memevault payload.
+// Version 0 is the legacy unframed format: a bare age ciphertext.
+type Frame struct {
+	Version uint8
+	Kind    Kind
+	Flags   Flags
+	Payload []byte
+}
+
+// NewFrame returns a current-version frame for the given payload.
+func NewFrame(kind Kind, flags Flags, payload []byte) *Frame {
+	return &Frame{Version: FormatVersion, Kind: kind, Flags: flags, Payload: payload}
+}
+
+// EncodeFrame serializes the frame with its header and checksum.
+func EncodeFrame(f *Frame) []byte {
+	buf := make([]byte, frameHeaderSize, frameHeaderSize+len(f.Payload))
+	copy(buf[0:4], FrameMagic)
+	buf[4] = FormatVersion
+	buf[5] = byte(f.Kind)
+	binary.LittleEndian.PutUint16(buf[6:8], uint16(f.Flags))
+	binary.LittleEndian.PutUint32(buf[8:12], crc32.ChecksumIEEE(f.Payload))
+	binary.LittleEndian.PutUint64(buf[12:20], uint64(len(f.Payload)))
+	return append(buf, f.Payload...)
+}
+
+// DecodeFrame parses a payload blob. Blobs that do not start with FrameMagic
+// are treated as legacy (version 0) payloads holding a bare age ciphertext.
+func DecodeFrame(data []byte) (*Frame, error) {
+	if !IsFrame(data) {
+		return &Frame{Version: 0, Kind: KindSecrets, Flags: FlagEncrypted, Payload: data}, nil
+	}
+	if len(data) < frameHeaderSize {
+		return nil, errors.New("truncated memevault frame header")
+	}
+
+	version := data[4]
+	if version == 0 || version > FormatVersion {
+		return nil, fmt.Errorf("unsupported vault format version %d (this build supports up to %d); please upgrade memevault", version, FormatVersion)
+	}
+
+	flags := Flags(binary.LittleEndian.Uint16(data[6:8]))
+	if unknown := flags &^ knownFlags; unknown != 0 {
+		return nil, fmt.Errorf("vault uses unsupported format flags 0x%04x; please upgrade memevault", uint16(unknown))
+	}
+
+	checksum := binary.LittleEndian.Uint32(data[8:12])
+	length := binary.LittleEndian.Uint64(data[12:20])
+	if length != uint64(len(data)-frameHeaderSize) {
+		return nil, errors.New("memevault frame length does not match payload size")
+	}
+
+	payload := data[frameHeaderSize:]
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, errors.New("memevault frame checksum mismatch (vault file is corrupted)")
+	}
+
+	return &Frame{Version: version, Kind: Kind(data[5]), Flags: flags, Payload: payload}, nil
+}
+
+// IsFrame reports whether data starts with the frame magic.
+func IsFrame(data []byte) bool {
+	return bytes.HasPrefix(data, FrameMagic)
+}
@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame *Frame
+	}{
+		{"secrets", NewFrame(KindSecrets, FlagEncrypted, []byte("age-ciphertext"))},
+		{"bundle", NewFrame(KindBundle, 0, []byte(`{"default":"..."}`))},
+		{"all flags", NewFrame(KindSecrets, FlagEncrypted|FlagPadded|FlagCompressed, []byte{0, 1, 2, 0xFF})},
+		{"empty payload", NewFrame(KindSecrets, FlagEncrypted, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := EncodeFrame(tt.frame)
+			if !IsFrame(data) {
+				t.Fatalf("EncodeFrame output doesn't start with %q", FrameMagic)
+			}
+			got, err := DecodeFrame(data)
+			if err != nil {
+				t.Fatalf("DecodeFrame: %v", err)
+			}
+			if got.Version != FormatVersion || got.Kind != tt.frame.Kind || got.Flags != tt.frame.Flags || !bytes.Equal(got.Payload, tt.frame.Payload) {
+				t.Errorf("DecodeFrame = %+v, want %+v", got, tt.frame)
+			}
+		})
+	}
+}
+
+func TestDecodeFrameLegacy(t *testing.T) {
+	for _, data := range [][]byte{[]byte("age-encryption.org/v1\n..."), {0x01, 0x02}} {
+		got, err := DecodeFrame(data)
+		if err != nil {
+			t.Fatalf("DecodeFrame(%q): %v", data, err)
+		}
+		if got.Version != 0 || got.Kind != KindSecrets || got.Flags != FlagEncrypted || !bytes.Equal(got.Payload, data) {
+			t.Errorf("DecodeFrame(%q) = %+v, want a v0 encrypted secrets frame", data, got)
+		}
+	}
+}
+
+func TestDecodeFrameErrors(t *testing.T) {
+	valid := EncodeFrame(NewFrame(KindSecrets, FlagEncrypted, []byte("payload")))
+	modified := func(f func(data []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"truncated header", valid[:frameHeaderSize-1], "truncated memevault frame header"},
+		{"version 0", modified(func(d []byte) []byte { d[4] = 0; return d }), "unsupported vault format version 0"},
+		{"newer version", modified(func(d []byte) []byte { d[4] = FormatVersion + 1; return d }), "please upgrade memevault"},
+		{"unknown flags", modified(func(d []byte) []byte { binary.LittleEndian.PutUint16(d[6:8], uint16(FlagEncrypted|0x0100)); return d }), "unsupported format flags 0x0100"},
+		{"truncated payload", valid[:len(valid)-1], "length does not match"},
+		{"extra bytes", append(append([]byte(nil), valid...), 0), "length does not match"},
+		{"bad checksum", modified(func(d []byte) []byte { d[len(d)-1] ^= 1; return d }), "checksum mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeFrame(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("DecodeFrame error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package vault
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Expanded returns the secrets visible in the opened environment (see
+// Resolved) with the given templates expanded, or every template when no keys
+// are given. A template may contain ${KEY} to insert the value of KEY
+// (expanded too if it is a template); $$ is a literal $ and any other $ is
+// kept as is. Values stored with Set are never expanded.
+//
+// Undefined keys and reference cycles only affect the templates being
+// expanded that run into them: those are left out of the returned map, and
+// reported in a *TemplateError returned along with it.
+func (v *Vault) Expanded(keys ...string) (SecretsMap, error) {
+	secrets, templates, err := v.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		keys = secrets.Keys()
+	}
+
+	e := &expander{secrets: secrets, templates: templates, done: SecretsMap{}}
+	expanded := maps.Clone(secrets)
+	broken := &TemplateError{Errs: map[string]error{}}
+	for _, k := range keys {
+		if _, ok := secrets[k]; !ok {
+			continue
+		}
+		val, err := e.expand(k, nil)
+		if err != nil {
+			broken.Errs[k] = err
+			delete(expanded, k)
+			continue
+		}
+		expanded[k] = val
+	}
+	if len(broken.Errs) > 0 {
+		return expanded, broken
+	}
+	return expanded, nil
+}
+
+// TemplateError lists the templates Expanded couldn't expand.
+type TemplateError struct {
+	// Errs maps each template to the reason it couldn't be expanded.
+	Errs map[string]error
+}
+
+// Keys returns the templates that couldn't be expanded in sorted order.
+func (e *TemplateError) Keys() []string {
+	keys := make([]string, 0, len(e.Errs))
+	for k := range e.Errs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *TemplateError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, k := range e.Keys() {
+		msgs = append(msgs, e.Errs[k].Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// References returns the templates visible in the opened environment that
+// use key, directly or through other templates, in sorted order.
+func (v *Vault) References(key string) ([]string, error) {
+	secrets, templates, err := v.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	// users maps each key to the templates referencing it
+	users := map[string][]string{}
+	for _, k := range secrets.Keys() {
+		if templates[k] {
+			for _, ref := range templateRefs(k, secrets[k]) {
+				users[ref] = append(users[ref], k)
+			}
+		}
+	}
+
+	seen := map[string]bool{key: true}
+	queue := []string{key}
+	for len(queue) > 0 {
+		for _, user := range users[queue[0]] {
+			if !seen[user] {
+				seen[user] = true
+				queue = append(queue, user)
+			}
+		}
+		queue = queue[1:]
+	}
+	delete(seen, key)
+
+	refs := make([]string, 0, len(seen))
+	for k := range seen {
+		refs = append(refs, k)
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+type expander struct {
+	secrets   SecretsMap
+	templates map[string]bool
+	done      SecretsMap
+}
+
+// expand returns the value of key, expanded if it is a template; stack holds
+// the templates being expanded.
+func (e *expander) expand(key string, stack []string) (string, error) {
+	raw := e.secrets[key]
+	if !e.templates[key] {
+		return raw, nil
+	}
+	if val, ok := e.done[key]; ok {
+		return val, nil
+	}
+	if slices.Contains(stack, key) {
+		return "", fmt.Errorf("reference cycle: %s -> %s", strings.Join(stack, " -> "), key)
+	}
+	stack = append(stack[:len(stack):len(stack)], key)
+
+	val, err := renderTemplate(key, raw, func(ref string) (string, error) {
+		if _, ok := e.secrets[ref]; !ok {
+			return "", fmt.Errorf("%s: reference to undefined key ${%s}", key, ref)
+		}
+		return e.expand(ref, stack)
+	})
+	if err != nil {
+		return "", err
+	}
+	e.done[key] = val
+	return val, nil
+}
+
+// checkTemplate reports syntax errors in the template stored under key.
+func checkTemplate(key, raw string) error {
+	_, err := renderTemplate(key, raw, func(string) (string, error) { return "", nil })
+	return err
+}
+
+// templateRefs returns the keys the template stored under key references.
+func templateRefs(key, raw string) []string {
+	var refs []string
+	renderTemplate(key, raw, func(ref string) (string, error) {
+		refs = append(refs, ref)
+		return "", nil
+	})
+	return refs
+}
+
+// renderTemplate replaces the ${KEY} references in raw with the values
+// lookup returns for them, and $$ with $.
+func renderTemplate(key, raw string, lookup func(ref string) (string, error)) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '$' || i+1 == len(raw) {
+			b.WriteByte(raw[i])
+			continue
+		}
+
+		switch raw[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(raw[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("%s: unterminated ${ (use $$ for a literal $)", key)
+			}
+			ref := raw[i+2 : i+2+end]
+			if !ValidKey(ref) {
+				return "", fmt.Errorf("%s: invalid reference ${%s}", key, ref)
+			}
+			val, err := lookup(ref)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(val)
+			i += 2 + end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
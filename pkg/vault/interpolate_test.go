@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testTemplates returns an unsaved vault holding secrets; values starting
+// with "=" are stored as templates.
+func testTemplates(t *testing.T, secrets map[string]string) *Vault {
+	t.Helper()
+	v := New(filepath.Join(t.TempDir(), "vault"), nil)
+	for k, val := range secrets {
+		var err error
+		if strings.HasPrefix(val, "=") {
+			err = v.SetTemplate(k, val[1:])
+		} else {
+			err = v.Set(k, val)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return v
+}
+
+func TestExpanded(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets map[string]string
+		keys    []string
+		want    SecretsMap
+		broken  map[string]string // key -> error
+	}{
+		{
+			name:    "references",
+			secrets: map[string]string{"HOST": "db", "PORT": "5432", "URL": "=postgres://${HOST}:${PORT}", "OUTER": "=[${URL}]"},
+			want:    SecretsMap{"HOST": "db", "PORT": "5432", "URL": "postgres://db:5432", "OUTER": "[postgres://db:5432]"},
+		},
+		{
+			name:    "literal values are never expanded",
+			secrets: map[string]string{"A": "1", "LITERAL": "${A}", "PRICE": "=$$5 ${A} $x"},
+			want:    SecretsMap{"A": "1", "LITERAL": "${A}", "PRICE": "$5 1 $x"},
+		},
+		{
+			name:    "missing key",
+			secrets: map[string]string{"B": "2", "C": "=x${A}y", "D": "=${C}!", "E": "=${B}"},
+			want:    SecretsMap{"B": "2", "E": "2"},
+			broken:  map[string]string{"C": "C: reference to undefined key ${A}", "D": "C: reference to undefined key ${A}"},
+		},
+		{
+			name:    "cycle",
+			secrets: map[string]string{"A": "=${B}", "B": "=${A}", "C": "ok"},
+			want:    SecretsMap{"C": "ok"},
+			broken:  map[string]string{"A": "reference cycle: A -> B -> A", "B": "reference cycle: B -> A -> B"},
+		},
+		{
+			name:    "only the given keys",
+			secrets: map[string]string{"B": "2", "C": "=x${A}y", "E": "=${B}"},
+			keys:    []string{"E"},
+			want:    SecretsMap{"B": "2", "C": "x${A}y", "E": "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testTemplates(t, tt.secrets).Expanded(tt.keys...)
+			var broken *TemplateError
+			if len(tt.broken) == 0 && err != nil {
+				t.Fatalf("Expanded: %v", err)
+			}
+			if len(tt.broken) > 0 {
+				if !errors.As(err, &broken) {
+					t.Fatalf("Expanded error = %v, want a *TemplateError", err)
+				}
+				if len(broken.Errs) != len(tt.broken) {
+					t.Errorf("broken templates = %v, want %v", broken.Keys(), tt.broken)
+				}
+				for k, want := range tt.broken {
+					if broken.Errs[k] == nil || broken.Errs[k].Error() != want {
+						t.Errorf("error for %s = %v, want %q", k, broken.Errs[k], want)
+					}
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("Expanded = %q, want %q", got, tt.want)
+			}
+			for k, want := range tt.want {
+				if got[k] != want {
+					t.Errorf("%s = %q, want %q", k, got[k], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetTemplateErrors(t *testing.T) {
+	v := testTemplates(t, nil)
+	for val, want := range map[string]string{
+		"${A":       "unterminated ${",
+		"${1A}":     "invalid reference ${1A}",
+		"\xff${A}":  "binary values can't be templates",
+		"${A-B} ok": "invalid reference ${A-B}",
+	} {
+		if err := v.SetTemplate("T", val); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("SetTemplate(%q) = %v, want an error containing %q", val, err, want)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	v := testTemplates(t, map[string]string{
+		"A":     "1",
+		"C":     "=x${A}y",
+		"D":     "=${C}!",
+		"E":     "=${B}",
+		"LOOP1": "=${LOOP2}${A}",
+		"LOOP2": "=${LOOP1}",
+		"PLAIN": "${A}",
+	})
+	tests := map[string][]string{
+		"A":     {"C", "D", "LOOP1", "LOOP2"},
+		"B":     {"E"},
+		"C":     {"D"},
+		"PLAIN": {},
+	}
+	for key, want := range tests {
+		got, err := v.References(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("References(%s) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// jpegAppMarker is APP15, which no common tool or metadata standard uses.
+	jpegAppMarker = 0xEF
+	// jpegMaxSegment is the largest segment length field (it counts itself).
+	jpegMaxSegment = 0xFFFF
+)
+
+// jpegSegmentID prefixes the data of every payload segment, followed by the
+// segment index and count (uint16 each, big endian) and a slice of the payload.
+var jpegSegmentID = []byte("MEMEVAULT\x00")
+
+// jpegChunkSize is how much payload fits in a single segment.
+var jpegChunkSize = jpegMaxSegment - 2 - len(jpegSegmentID) - 4
+
+// jpegContainer stores the payload across APP15 segments at the start of the
+// file, so it survives tools that drop data after the EOI marker. The segments
+// go right after SOI, behind any leading JFIF (APP0) or Exif (APP1) segments,
+// which decoders expect to come first. Payloads appended after EOI by older
+// versions are still read, and moved into segments on the next save.
+type jpegContainer struct{}
+
+func (jpegContainer) Name() string { return "jpeg" }
+
+func (jpegContainer) Extract(data []byte) ([]byte, error) {
+	segments, _, err := scanJPEGHeader(data)
+	if err != nil {
+		if blob, terr := (trailerContainer{}).Extract(data); terr == nil {
+			return blob, nil
+		}
+		return nil, err
+	}
+
+	var chunks [][]byte
+	for _, s := range segments {
+		body, ok := s.payload(data)
+		if !ok {
+			continue
+		}
+		index := int(binary.BigEndian.Uint16(body[0:2]))
+		count := int(binary.BigEndian.Uint16(body[2:4]))
+		if chunks == nil {
+			chunks = make([][]byte, count)
+		}
+		if count != len(chunks) || index >= count || chunks[index] != nil {
+			return nil, errors.New("inconsistent memevault JPEG segments")
+		}
+		chunks[index] = body[4:]
+	}
+
+	if chunks == nil {
+		// Legacy vault: payload appended after EOI
+		return trailerContainer{}.Extract(data)
+	}
+
+	for i, c := range chunks {
+		if c == nil {
+			return nil, fmt.Errorf("memevault JPEG segment %d of %d is missing", i+1, len(chunks))
+		}
+	}
+	return bytes.Join(chunks, nil), nil
+}
+
+func (jpegContainer) Embed(data, blob []byte) ([]byte, error) {
+	data = stripTrailer(data)
+	segments, _, err := scanJPEGHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	count := (len(blob) + jpegChunkSize - 1) / jpegChunkSize
+	if count > 0xFFFF {
+		return nil, errors.New("payload too large for JPEG segments")
+	}
+
+	// Find where the leading JFIF/Exif segments end
+	insertAt := 2
+	for _, s := range segments {
+		if s.marker != 0xE0 && s.marker != 0xE1 {
+			break
+		}
+		insertAt = s.end
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+len(blob)+count*(4+len(jpegSegmentID)+4)))
+	out.Write(data[:insertAt])
+	for i := 0; i < count; i++ {
+		chunk := blob[i*jpegChunkSize : min(len(blob), (i+1)*jpegChunkSize)]
+		var header [8]byte
+		header[0], header[1] = 0xFF, jpegAppMarker
+		binary.BigEndian.PutUint16(header[2:4], uint16(2+len(jpegSegmentID)+4+len(chunk)))
+		binary.BigEndian.PutUint16(header[4:6], uint16(i))
+		binary.BigEndian.PutUint16(header[6:8], uint16(count))
+		out.Write(header[0:4])
+		out.Write(jpegSegmentID)
+		out.Write(header[4:8])
+		out.Write(chunk)
+	}
+
+	// Copy the rest, dropping any payload segments from a previous save
+	pos := insertAt
+	for _, s := range segments {
+		if s.start < insertAt {
+			continue
+		}
+		if _, ok := s.payload(data); ok {
+			out.Write(data[pos:s.start])
+			pos = s.end
+		}
+	}
+	out.Write(data[pos:])
+
+	return out.Bytes(), nil
+}
+
+type jpegSegment struct {
+	marker     byte
+	start, end int
+}
+
+// payload returns the segment data after the memevault identifier, if this
+// is one of our segments.
+func (s jpegSegment) payload(data []byte) ([]byte, bool) {
+	if s.marker != jpegAppMarker {
+		return nil, false
+	}
+	body := data[s.start+4 : s.end]
+	if !bytes.HasPrefix(body, jpegSegmentID) || len(body) < len(jpegSegmentID)+4 {
+		return nil, false
+	}
+	return body[len(jpegSegmentID):], true
+}
+
+// scanJPEGHeader lists the marker segments between SOI and the start of scan
+// (SOS), returning them and the offset of the SOS marker.
+func scanJPEGHeader(data []byte) ([]jpegSegment, int, error) {
+	if !bytes.HasPrefix(data, jpegMagic) {
+		return nil, 0, errors.New("not a JPEG file")
+	}
+
+	var segments []jpegSegment
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, 0, errors.New("malformed JPEG header")
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte before a marker
+			pos++
+			continue
+		case marker == 0xDA:
+			return segments, pos, nil
+		case marker == 0xD9:
+			return nil, 0, errors.New("JPEG has no image data")
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Standalone markers without a length
+			pos += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil, 0, errors.New("invalid JPEG segment length")
+		}
+		segments = append(segments, jpegSegment{marker: marker, start: pos, end: pos + 2 + length})
+		pos += 2 + length
+	}
+}
@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"bytes"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+func TestJPEGRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		size int
+	}{
+		{"plain", testJPEG(t, 16, 16), 100},
+		{"with JFIF", testJFIF(t, 16, 16), 100},
+		{"multi-segment", testJPEG(t, 16, 16), 2*jpegChunkSize + 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testRoundTrip(t, tt.data, tt.size)
+		})
+	}
+}
+
+func TestJPEGSegmentsKeepImageValid(t *testing.T) {
+	for _, data := range [][]byte{testJPEG(t, 16, 16), testJFIF(t, 16, 16)} {
+		out, err := jpegContainer{}.Embed(data, testBlob(2*jpegChunkSize+100, 1))
+		if err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+		if data[3] == 0xE0 && !bytes.Equal(out[:4], data[:4]) {
+			t.Errorf("Embed moved the JFIF segment: % x, want % x", out[:4], data[:4])
+		}
+		if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+			t.Errorf("JPEG with payload segments doesn't decode: %v", err)
+		}
+		if _, _, err := locateTrailer(out); err == nil {
+			t.Error("Embed appended a trailer to a JPEG")
+		}
+	}
+}
+
+func TestJPEGSegmentErrors(t *testing.T) {
+	out, err := jpegContainer{}.Embed(testJPEG(t, 16, 16), testBlob(2*jpegChunkSize+100, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments, _, err := scanJPEGHeader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the second payload segment
+	var second jpegSegment
+	n := 0
+	for _, s := range segments {
+		if _, ok := s.payload(out); ok {
+			if n++; n == 2 {
+				second = s
+			}
+		}
+	}
+	missing := append(append([]byte(nil), out[:second.start]...), out[second.end:]...)
+	if _, err := (jpegContainer{}).Extract(missing); err == nil || !strings.Contains(err.Error(), "segment 2 of 3 is missing") {
+		t.Errorf("Extract with a missing segment: %v", err)
+	}
+}
+
+func TestJPEGLegacyTrailerMigration(t *testing.T) {
+	testTrailerMigration(t, testJPEG(t, 16, 16), func(out []byte) bool {
+		segments, _, err := scanJPEGHeader(out)
+		if err != nil {
+			return false
+		}
+		for _, s := range segments {
+			if _, ok := s.payload(out); ok {
+				return true
+			}
+		}
+		return false
+	})
+}
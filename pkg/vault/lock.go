@@ -0,0 +1,49 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrLocked is returned when another process holds the vault lock.
+var ErrLocked = errors.New("vault is locked by another process")
+
+// lockPollInterval is how often a held lock is retried while waiting.
+const lockPollInterval = 100 * time.Millisecond
+
+// Lock is an exclusive advisory lock guarding a vault's load-modify-save cycle.
+// It is held on a sidecar "<vault>.lock" file, since the vault itself is
+// replaced by rename on every save.
+type Lock struct {
+	f    *os.File
+	path string
+}
+
+// LockFile acquires the lock for the vault at path, waiting up to timeout for
+// another process to release it. A zero timeout fails immediately if held.
+func LockFile(path string, timeout time.Duration) (*Lock, error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(timeout)
+
+	for {
+		f, ok, err := acquire(lockPath)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &Lock{f: f, path: lockPath}, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: %s (gave up after %s)", ErrLocked, path, timeout)
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// Unlock releases the lock and removes the lock file.
+func (l *Lock) Unlock() error {
+	return release(l.f, l.path)
+}
@@ -0,0 +1,50 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows
+
+package vault
+
+import "os"
+
+// acquire takes an advisory lock on the lock file, reporting false if another
+// process holds it.
+func acquire(lockPath string) (*os.File, bool, error) {
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ok, err := tryLock(f)
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	if ok {
+		// The previous holder may have removed the lock file after we
+		// opened it; only a lock on the file currently at lockPath counts.
+		if sameFile(f, lockPath) {
+			return f, true, nil
+		}
+		unlock(f)
+	}
+	f.Close()
+	return nil, false, nil
+}
+
+func release(f *os.File, lockPath string) error {
+	// Remove while still holding the lock so waiters notice via sameFile.
+	// This fails harmlessly on platforms that can't delete open files.
+	os.Remove(lockPath)
+	unlock(f)
+	return f.Close()
+}
+
+func sameFile(f *os.File, path string) bool {
+	held, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(held, current)
+}
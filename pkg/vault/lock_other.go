@@ -0,0 +1,32 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package vault
+
+import (
+	"fmt"
+	"os"
+)
+
+// acquire creates the lock file exclusively, since advisory locks aren't
+// available here: whoever creates it holds the lock. Unlike an advisory lock,
+// the file outlives a process that crashes while holding it, so it then has
+// to be removed by hand.
+func acquire(lockPath string) (*os.File, bool, error) {
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	return f, true, nil
+}
+
+func release(f *os.File, lockPath string) error {
+	err := f.Close()
+	if rerr := os.Remove(lockPath); err == nil {
+		err = rerr
+	}
+	return err
+}
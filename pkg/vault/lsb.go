@@ -0,0 +1,176 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// StegoMode selects how payloads are hidden in lossless images (PNG, BMP).
+type StegoMode string
+
+const (
+	// StegoAuto keeps whatever mode the vault already uses.
+	StegoAuto StegoMode = ""
+	// StegoLSB spreads the payload across the least significant bits of the pixels.
+	StegoLSB StegoMode = "lsb"
+	// StegoNone stores the payload alongside the pixels (chunk or trailer).
+	StegoNone StegoMode = "none"
+)
+
+// ParseStegoMode validates a --stego flag value.
+func ParseStegoMode(s string) (StegoMode, error) {
+	switch m := StegoMode(s); m {
+	case StegoAuto, StegoLSB, StegoNone:
+		return m, nil
+	case "auto":
+		return StegoAuto, nil
+	}
+	return "", fmt.Errorf("unknown stego mode %q (expected auto, lsb or none)", s)
+}
+
+// lsbHeaderSize is the payload length prefix written before the blob.
+const lsbHeaderSize = 4
+
+// lsbCapable is implemented by containers that support StegoLSB.
+type lsbCapable interface {
+	carrier(data []byte) (*lsbCarrier, error)
+}
+
+// Capacity reports how many payload bytes the image can hold with StegoLSB.
+func Capacity(data []byte) (int, error) {
+	c, err := DetectContainer(data, Options{})
+	if err != nil {
+		return 0, err
+	}
+	lc, ok := c.(lsbCapable)
+	if !ok {
+		return 0, fmt.Errorf("LSB steganography needs a lossless PNG or BMP image, not %s", c.Name())
+	}
+	carrier, err := lc.carrier(data)
+	if err != nil {
+		return 0, err
+	}
+	return carrier.capacity(), nil
+}
+
+// lsbCarrier exposes the color channel bytes of a decoded image. Channel i
+// lives at buf[offset(i)]; each one holds a single payload bit.
+type lsbCarrier struct {
+	buf      []byte
+	channels int
+	offset   func(i int) int
+}
+
+func (c *lsbCarrier) capacity() int {
+	return max(0, c.channels/8-lsbHeaderSize)
+}
+
+// write stores [Blob Length (4 bytes)] [Blob] in the channels picked by the key.
+func (c *lsbCarrier) write(key []byte, blob []byte) error {
+	if len(blob) > c.capacity() {
+		return fmt.Errorf("image too small for vault: payload needs %d bytes but the image holds %d", len(blob), c.capacity())
+	}
+
+	data := make([]byte, lsbHeaderSize, lsbHeaderSize+len(blob))
+	binary.LittleEndian.PutUint32(data, uint32(len(blob)))
+	data = append(data, blob...)
+
+	c.writeBits(lsbOrder(key, c.channels, len(data)*8), data)
+	return nil
+}
+
+// scrub overwrites the payload stored by write, if there is one, with random
+// bits, so the old ciphertext doesn't linger in the pixels once the vault is
+// stored elsewhere. It reports whether there was a payload.
+func (c *lsbCarrier) scrub(key []byte) (bool, error) {
+	blob, err := c.read(key)
+	if err != nil {
+		return false, nil
+	}
+	noise := make([]byte, lsbHeaderSize+len(blob))
+	if _, err := rand.Read(noise); err != nil {
+		return false, err
+	}
+	c.writeBits(lsbOrder(key, c.channels, len(noise)*8), noise)
+	return true, nil
+}
+
+// writeBits stores the bits of data in the channels listed by order.
+func (c *lsbCarrier) writeBits(order []int, data []byte) {
+	for i, pos := range order {
+		bit := (data[i/8] >> (7 - uint(i%8))) & 1
+		off := c.offset(pos)
+		c.buf[off] = c.buf[off]&^1 | bit
+	}
+}
+
+// read returns the blob stored by write, or an error if the image carries none.
+func (c *lsbCarrier) read(key []byte) ([]byte, error) {
+	// The ordering is prefix-stable, so the header can be read on its own
+	// before we know how long the payload is.
+	head := c.bytes(lsbOrder(key, c.channels, (lsbHeaderSize+len(FrameMagic))*8))
+	if head == nil || !bytes.Equal(head[lsbHeaderSize:], FrameMagic) {
+		return nil, errors.New("no LSB payload found in image")
+	}
+
+	length := int(binary.LittleEndian.Uint32(head[:lsbHeaderSize]))
+	if length > c.capacity() {
+		return nil, errors.New("invalid LSB payload length")
+	}
+
+	data := c.bytes(lsbOrder(key, c.channels, (lsbHeaderSize+length)*8))
+	return data[lsbHeaderSize:], nil
+}
+
+func (c *lsbCarrier) bytes(order []int) []byte {
+	if order == nil {
+		return nil
+	}
+	out := make([]byte, len(order)/8)
+	for i, pos := range order {
+		out[i/8] |= (c.buf[c.offset(pos)] & 1) << (7 - uint(i%8))
+	}
+	return out
+}
+
+// lsbOrder returns the first count entries of a key-derived permutation of
+// [0, n), using a partial Fisher-Yates shuffle driven by AES-CTR so the order
+// is identical across platforms and Go releases. It returns nil if count > n.
+func lsbOrder(key []byte, n, count int) []int {
+	if count > n {
+		return nil
+	}
+
+	seed := sha256.Sum256(append([]byte("memevault-lsb-v1:"), key...))
+	block, _ := aes.NewCipher(seed[:])
+	stream := cipher.NewCTR(block, make([]byte, aes.BlockSize))
+	var rnd [8]byte
+
+	// Only swapped entries are tracked, so large images stay cheap
+	swapped := make(map[int]int, count)
+	at := func(i int) int {
+		if v, ok := swapped[i]; ok {
+			return v
+		}
+		return i
+	}
+
+	out := make([]int, count)
+	for i := 0; i < count; i++ {
+		for k := range rnd {
+			rnd[k] = 0
+		}
+		stream.XORKeyStream(rnd[:], rnd[:])
+		j := i + int(binary.LittleEndian.Uint64(rnd[:])%uint64(n-i))
+
+		out[i] = at(j)
+		swapped[j] = at(i)
+	}
+	return out
+}
@@ -0,0 +1,203 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCapacity(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    int
+		wantErr string
+	}{
+		{"png", testPNG(t, 16, 16), 16*16*3/8 - lsbHeaderSize, ""},
+		{"bmp 24 bit", testBMP(16, 16, 24), 16*16*3/8 - lsbHeaderSize, ""},
+		{"bmp 32 bit", testBMP(10, 10, 32), 10*10*3/8 - lsbHeaderSize, ""},
+		{"tiny image", testPNG(t, 2, 2), 0, ""},
+		{"bmp 8 bit", testBMP(16, 16, 8), 0, "needs a 24 or 32 bit BMP"},
+		{"jpeg", testJPEG(t, 16, 16), 0, "not jpeg"},
+		{"gif", testGIF(t), 0, "not gif"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Capacity(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Capacity error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Capacity = %d, %v; want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLSBRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		key  []byte
+	}{
+		{"png", testPNG(t, 32, 32), nil},
+		{"png with key", testPNG(t, 32, 32), []byte("shared secret")},
+		{"bmp", testBMP(32, 32, 24), nil},
+		{"bmp 32 bit with key", testBMP(32, 32, 32), []byte("shared secret")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lsb := Options{Stego: StegoLSB, StegoKey: tt.key}
+			c, err := DetectContainer(tt.data, lsb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blob := testBlob(100, 1)
+			out, err := c.Embed(tt.data, blob)
+			if err != nil {
+				t.Fatalf("Embed: %v", err)
+			}
+			if bytes.Contains(out, FrameMagic) {
+				t.Error("LSB payload is visible in the file")
+			}
+			if got, err := c.Extract(out); err != nil || !bytes.Equal(got, blob) {
+				t.Fatalf("Extract = %d bytes, %v; want the embedded payload", len(got), err)
+			}
+
+			// Auto mode keeps the vault in the pixels
+			auto, _ := DetectContainer(out, Options{StegoKey: tt.key})
+			again, err := auto.Embed(out, testBlob(100, 2))
+			if err != nil {
+				t.Fatalf("Embed in auto mode: %v", err)
+			}
+			if bytes.Contains(again, FrameMagic) {
+				t.Error("auto mode moved the payload out of the pixels")
+			}
+			if got, err := auto.Extract(again); err != nil || !bytes.Equal(got, testBlob(100, 2)) {
+				t.Errorf("Extract after auto Embed = %d bytes, %v", len(got), err)
+			}
+
+			// With the wrong key the payload can't be found
+			wrong := []byte("wrong key")
+			if bytes.Equal(tt.key, wrong) {
+				t.Fatal("test uses the wrong key")
+			}
+			other, _ := DetectContainer(out, Options{StegoKey: wrong})
+			if _, err := other.Extract(out); err == nil || !strings.Contains(err.Error(), "no memevault payload found") {
+				t.Errorf("Extract with the wrong key: %v", err)
+			}
+		})
+	}
+}
+
+func TestLSBTooSmall(t *testing.T) {
+	for _, data := range [][]byte{testPNG(t, 8, 8), testBMP(8, 8, 24)} {
+		capacity, err := Capacity(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, _ := DetectContainer(data, Options{Stego: StegoLSB})
+		if _, err := c.Embed(data, testBlob(capacity, 1)); err == nil || !strings.Contains(err.Error(), "image too small for vault") {
+			t.Errorf("%s: Embed of a payload larger than the capacity: %v", c.Name(), err)
+		}
+		fits := testBlob(capacity-frameHeaderSize, 1)
+		if _, err := c.Embed(data, fits); err != nil {
+			t.Errorf("%s: Embed of a payload filling the capacity: %v", c.Name(), err)
+		}
+	}
+}
+
+func TestLSBLeavingLSBMode(t *testing.T) {
+	for _, data := range [][]byte{testPNG(t, 32, 32), testBMP(32, 32, 24)} {
+		lsb, _ := DetectContainer(data, Options{Stego: StegoLSB})
+		out, err := lsb.Embed(data, testBlob(100, 1))
+		if err != nil {
+			t.Fatalf("%s: Embed: %v", lsb.Name(), err)
+		}
+
+		none, _ := DetectContainer(out, Options{Stego: StegoNone})
+		moved, err := none.Embed(out, testBlob(100, 2))
+		if err != nil {
+			t.Fatalf("%s: Embed without LSB: %v", lsb.Name(), err)
+		}
+		if got, err := none.Extract(moved); err != nil || !bytes.Equal(got, testBlob(100, 2)) {
+			t.Errorf("%s: Extract after leaving LSB mode = %d bytes, %v", lsb.Name(), len(got), err)
+		}
+		carrier, err := lsbCarrierOf(moved)
+		if err != nil {
+			t.Fatalf("%s: %v", lsb.Name(), err)
+		}
+		if _, err := carrier.read(nil); err == nil {
+			t.Errorf("%s: the old LSB payload is still in the pixels", lsb.Name())
+		}
+	}
+}
+
+// lsbCarrierOf returns the LSB carrier of a PNG or BMP image.
+func lsbCarrierOf(data []byte) (*lsbCarrier, error) {
+	if bytes.HasPrefix(data, pngMagic) {
+		return pngContainer{}.carrier(data)
+	}
+	return bmpContainer{}.carrier(data)
+}
+
+func TestBMPCraftedHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset uint32
+		width  uint32
+		height uint32
+	}{
+		{"huge height", 54, 16, 0x7FFFFFFF},
+		{"huge width", 54, 0x7FFFFFFF, 1},
+		{"most negative height", 54, 16, 0x80000000},
+		{"offset past the end", 0xFFFFFFFF, 16, 16},
+		{"zero width", 54, 0, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testBMP(16, 16, 24)
+			binary.LittleEndian.PutUint32(data[10:14], tt.offset)
+			binary.LittleEndian.PutUint32(data[18:22], tt.width)
+			binary.LittleEndian.PutUint32(data[22:26], tt.height)
+			if _, err := Capacity(data); err == nil || !strings.Contains(err.Error(), "invalid BMP dimensions") {
+				t.Errorf("Capacity = %v, want invalid BMP dimensions", err)
+			}
+		})
+	}
+}
+
+func TestLSBOnLossyImage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.jpg")
+	if err := WriteFileAtomic(path, testJPEG(t, 16, 16), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := WriteFrame(path, NewFrame(KindSecrets, FlagEncrypted, []byte("x")), Options{Stego: StegoLSB})
+	if err == nil || !strings.Contains(err.Error(), "needs a lossless PNG or BMP image, not jpeg") {
+		t.Errorf("WriteFrame in LSB mode to a JPEG: %v", err)
+	}
+}
+
+func TestLSBOrder(t *testing.T) {
+	order := lsbOrder([]byte("key"), 100, 100)
+	seen := map[int]bool{}
+	for _, i := range order {
+		if i < 0 || i >= 100 || seen[i] {
+			t.Fatalf("lsbOrder isn't a permutation: %v", order)
+		}
+		seen[i] = true
+	}
+	// Readers rely on shorter orders being a prefix of longer ones
+	if prefix := lsbOrder([]byte("key"), 100, 10); !slices.Equal(prefix, order[:10]) {
+		t.Errorf("lsbOrder(10) = %v, want the prefix %v", prefix, order[:10])
+	}
+	if lsbOrder([]byte("key"), 10, 11) != nil {
+		t.Error("lsbOrder returned more positions than there are channels")
+	}
+}
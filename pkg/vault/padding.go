@@ -0,0 +1,74 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Padding is a size bucket policy for plaintext payloads, so the vault size
+// only changes when the secrets cross a bucket boundary.
+// Positive values pad to a multiple of that many bytes.
+type Padding int
+
+const (
+	// PadNone disables padding.
+	PadNone Padding = 0
+	// PadPowerOfTwo pads to the next power of two (at least minPowerOfTwo bytes).
+	PadPowerOfTwo Padding = -1
+)
+
+// minPowerOfTwo keeps tiny vaults from revealing their size.
+const minPowerOfTwo = 256
+
+// ParsePadding parses a --padding flag value: "none", "pow2" or a block size in bytes.
+func ParsePadding(s string) (Padding, error) {
+	switch s {
+	case "none", "0":
+		return PadNone, nil
+	case "pow2":
+		return PadPowerOfTwo, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return PadNone, fmt.Errorf("invalid padding %q (expected none, pow2 or a block size in bytes)", s)
+	}
+	return Padding(n), nil
+}
+
+// Pad appends ISO/IEC 7816-4 padding (0x80 then zeros) to data, growing it
+// to the bucket size. Data is returned unchanged with PadNone.
+func Pad(data []byte, p Padding) []byte {
+	if p == PadNone {
+		return data
+	}
+
+	// Always room for the 0x80 marker
+	size := len(data) + 1
+	if p == PadPowerOfTwo {
+		target := minPowerOfTwo
+		for target < size {
+			target *= 2
+		}
+		size = target
+	} else if rem := size % int(p); rem != 0 {
+		size += int(p) - rem
+	}
+
+	out := make([]byte, size)
+	copy(out, data)
+	out[len(data)] = 0x80
+	return out
+}
+
+// Unpad strips the padding added by Pad.
+func Unpad(data []byte) ([]byte, error) {
+	i := len(data) - 1
+	for i >= 0 && data[i] == 0 {
+		i--
+	}
+	if i < 0 || data[i] != 0x80 {
+		return nil, errors.New("invalid payload padding")
+	}
+	return data[:i], nil
+}
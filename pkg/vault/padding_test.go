@@ -0,0 +1,74 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		padding Padding
+		want    int
+	}{
+		{"none", 10, PadNone, 10},
+		{"pow2 minimum", 0, PadPowerOfTwo, minPowerOfTwo},
+		{"pow2 small", 10, PadPowerOfTwo, 256},
+		{"pow2 needs room for the marker", 256, PadPowerOfTwo, 512},
+		{"pow2 just fits", 511, PadPowerOfTwo, 512},
+		{"pow2 large", 5000, PadPowerOfTwo, 8192},
+		{"block", 10, Padding(4096), 4096},
+		{"block boundary", 4095, Padding(4096), 4096},
+		{"block overflow", 4096, Padding(4096), 8192},
+		{"block of one", 7, Padding(1), 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Repeat([]byte{0}, tt.size)
+			padded := Pad(data, tt.padding)
+			if len(padded) != tt.want {
+				t.Fatalf("len(Pad(%d bytes)) = %d, want %d", tt.size, len(padded), tt.want)
+			}
+			if tt.padding == PadNone {
+				return
+			}
+			got, err := Unpad(padded)
+			if err != nil {
+				t.Fatalf("Unpad: %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Unpad(Pad(data)) = %x, want %x", got, data)
+			}
+		})
+	}
+}
+
+func TestUnpadErrors(t *testing.T) {
+	for _, data := range [][]byte{nil, {}, {0, 0, 0}, {0x80, 0x01}, []byte("no marker")} {
+		if _, err := Unpad(data); err == nil {
+			t.Errorf("Unpad(%x) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestParsePadding(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Padding
+		wantErr bool
+	}{
+		{"none", PadNone, false},
+		{"0", PadNone, false},
+		{"pow2", PadPowerOfTwo, false},
+		{"4096", Padding(4096), false},
+		{"-1", PadNone, true},
+		{"4k", PadNone, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePadding(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePadding(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
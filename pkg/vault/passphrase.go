@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// PassphrasePrompt is called to read the passphrase of a protected identity
+// file; source names the file. When nil, protected identities can't be loaded.
+var PassphrasePrompt func(source string) (string, error)
+
+// ErrPassphraseRequired is returned when a protected identity is loaded
+// without a PassphrasePrompt.
+var ErrPassphraseRequired = errors.New("identity file is passphrase protected")
+
+// IsProtectedIdentity reports whether an identity file's contents are
+// encrypted with a passphrase.
+func IsProtectedIdentity(content []byte) bool {
+	return bytes.Contains(content, []byte(armor.Header))
+}
+
+// ProtectIdentity returns identity file contents holding the identity
+// encrypted with an age scrypt passphrase. The public key is kept as a
+// plaintext comment, so it can be shown without the passphrase.
+func ProtectIdentity(identity, publicKey, passphrase string) ([]byte, error) {
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "# Public Key: %s\n", publicKey)
+	a := armor.NewWriter(out)
+	w, err := age.Encrypt(a, recipient)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, identity+"\n"); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := a.Close(); err != nil {
+		return nil, err
+	}
+	out.WriteString("\n")
+
+	return out.Bytes(), nil
+}
+
+// unprotectIdentity decrypts a passphrase protected identity file.
+func unprotectIdentity(content []byte, source string) ([]byte, error) {
+	if PassphrasePrompt == nil {
+		return nil, fmt.Errorf("%s: %w", source, ErrPassphraseRequired)
+	}
+	passphrase, err := PassphrasePrompt(source)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	start := bytes.Index(content, []byte(armor.Header))
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(content[start:])), identity)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) || errors.Is(err, age.ErrIncorrectIdentity) {
+			return nil, fmt.Errorf("incorrect passphrase for %s", source)
+		}
+		return nil, fmt.Errorf("failed to decrypt %s: %v", source, err)
+	}
+	return io.ReadAll(r)
+}
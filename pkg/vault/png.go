@@ -0,0 +1,259 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+)
+
+// pngChunkType is the private ancillary chunk holding the payload.
+// Lowercase first letter: ancillary (decoders may ignore it).
+// Lowercase second letter: private (not a registered chunk type).
+// Lowercase fourth letter: safe to copy by editors that don't understand it.
+const pngChunkType = "mmVt"
+
+// pngContainer stores the payload in a private ancillary chunk placed right
+// before IEND, so the file stays a spec-compliant PNG. Payloads appended
+// after IEND by older versions are still read, and moved into the chunk on
+// the next save. With StegoLSB the payload goes into the pixels instead.
+type pngContainer struct {
+	opts Options
+}
+
+func (pngContainer) Name() string { return "png" }
+
+func (c pngContainer) Extract(data []byte) ([]byte, error) {
+	chunks, err := parsePNGChunks(data)
+	if err != nil {
+		// Damaged or unusual image; the legacy trailer may still be intact
+		if blob, terr := (trailerContainer{}).Extract(data); terr == nil {
+			return blob, nil
+		}
+		return nil, err
+	}
+
+	for _, chunk := range chunks {
+		if chunk.typ == pngChunkType {
+			return chunk.data, nil
+		}
+	}
+
+	// Legacy vault: payload appended after IEND
+	if blob, err := (trailerContainer{}).Extract(data); err == nil {
+		return blob, nil
+	}
+
+	carrier, err := c.carrier(data)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := carrier.read(c.opts.StegoKey)
+	if err != nil {
+		return nil, errors.New("no memevault payload found in PNG")
+	}
+	return blob, nil
+}
+
+func (c pngContainer) Embed(data, blob []byte) ([]byte, error) {
+	if c.useLSB(data) {
+		return c.embedLSB(data, blob)
+	}
+
+	data, err := c.scrubLSB(stripTrailer(data))
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := parsePNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)+len(blob)+12))
+	out.Write(pngMagic)
+	for _, c := range chunks {
+		switch c.typ {
+		case pngChunkType:
+			// Drop the old payload
+			continue
+		case "IEND":
+			writePNGChunk(out, pngChunkType, blob)
+		}
+		writePNGChunk(out, c.typ, c.data)
+	}
+	return out.Bytes(), nil
+}
+
+// useLSB decides whether to write in StegoLSB mode: when asked to, or in
+// auto mode when the image already carries an LSB payload.
+func (c pngContainer) useLSB(data []byte) bool {
+	switch c.opts.Stego {
+	case StegoLSB:
+		return true
+	case StegoNone:
+		return false
+	}
+	carrier, err := c.carrier(data)
+	if err != nil {
+		return false
+	}
+	_, err = carrier.read(c.opts.StegoKey)
+	return err == nil
+}
+
+func (c pngContainer) carrier(data []byte) (*lsbCarrier, error) {
+	_, carrier, err := decodePNGPixels(data)
+	return carrier, err
+}
+
+// embedLSB re-encodes the image with the payload in its pixels.
+func (c pngContainer) embedLSB(data, blob []byte) ([]byte, error) {
+	data = stripTrailer(data)
+	img, carrier, err := decodePNGPixels(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := carrier.write(c.opts.StegoKey, blob); err != nil {
+		return nil, err
+	}
+	return reencodePNG(data, img)
+}
+
+// scrubLSB returns data with any LSB payload overwritten, for vaults leaving
+// StegoLSB mode. Images without one are returned unchanged.
+func (c pngContainer) scrubLSB(data []byte) ([]byte, error) {
+	img, carrier, err := decodePNGPixels(data)
+	if err != nil {
+		return data, nil
+	}
+	if found, err := carrier.scrub(c.opts.StegoKey); err != nil || !found {
+		return data, err
+	}
+	return reencodePNG(data, img)
+}
+
+// reencodePNG encodes img, whose pixels were changed, as a replacement for
+// the PNG data. Ancillary chunks that are safe to copy (text and the like)
+// are carried over; the rest describe the old pixel data and are dropped, as
+// the PNG spec requires. The payload chunk is dropped too.
+func reencodePNG(data []byte, img *image.NRGBA) ([]byte, error) {
+	encoded := &bytes.Buffer{}
+	if err := png.Encode(encoded, img); err != nil {
+		return nil, err
+	}
+	newChunks, err := parsePNGChunks(encoded.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	oldChunks, err := parsePNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, encoded.Len()))
+	out.Write(pngMagic)
+	for _, chunk := range newChunks {
+		if chunk.typ == "IEND" {
+			for _, old := range oldChunks {
+				if isSafeToCopy(old.typ) && old.typ != pngChunkType {
+					writePNGChunk(out, old.typ, old.data)
+				}
+			}
+		}
+		writePNGChunk(out, chunk.typ, chunk.data)
+	}
+	return out.Bytes(), nil
+}
+
+// decodePNGPixels decodes the image into 8-bit NRGBA and exposes its RGB
+// channels as an LSB carrier. Alpha is left alone.
+func decodePNGPixels(data []byte) (*image.NRGBA, *lsbCarrier, error) {
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	img, ok := decoded.(*image.NRGBA)
+	if !ok {
+		b := decoded.Bounds()
+		img = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(img, img.Bounds(), decoded, b.Min, draw.Src)
+	}
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	carrier := &lsbCarrier{
+		buf:      img.Pix,
+		channels: w * h * 3,
+		offset: func(i int) int {
+			p := i / 3
+			return (p/w)*img.Stride + (p%w)*4 + i%3
+		},
+	}
+	return img, carrier, nil
+}
+
+// isSafeToCopy reports whether a chunk is ancillary and safe to copy
+// (lowercase first and fourth letters).
+func isSafeToCopy(typ string) bool {
+	return typ[0]&0x20 != 0 && typ[3]&0x20 != 0
+}
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// parsePNGChunks splits a PNG into its chunks, validating their CRCs.
+// Anything after IEND is ignored.
+func parsePNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngMagic) {
+		return nil, errors.New("not a PNG file")
+	}
+
+	var chunks []pngChunk
+	pos := len(pngMagic)
+	for {
+		if len(data)-pos < 12 {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		if length < 0 || length > len(data)-pos-12 {
+			return nil, errors.New("invalid PNG chunk length")
+		}
+		typ := data[pos+4 : pos+8]
+		body := data[pos+8 : pos+8+length]
+		crc := binary.BigEndian.Uint32(data[pos+8+length : pos+12+length])
+
+		h := crc32.NewIEEE()
+		h.Write(typ)
+		h.Write(body)
+		if h.Sum32() != crc {
+			return nil, errors.New("PNG chunk " + string(typ) + " has a bad CRC")
+		}
+
+		chunks = append(chunks, pngChunk{typ: string(typ), data: body})
+		pos += 12 + length
+
+		if string(typ) == "IEND" {
+			return chunks, nil
+		}
+	}
+}
+
+func writePNGChunk(buf *bytes.Buffer, typ string, data []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[0:4], uint32(len(data)))
+	copy(header[4:8], typ)
+	buf.Write(header[:])
+	buf.Write(data)
+
+	h := crc32.NewIEEE()
+	h.Write(header[4:8])
+	h.Write(data)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], h.Sum32())
+	buf.Write(crc[:])
+}
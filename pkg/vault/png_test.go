@@ -0,0 +1,43 @@
+package vault
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+func TestPNGRoundTrip(t *testing.T) {
+	testRoundTrip(t, testPNG(t, 16, 16), 100)
+}
+
+func TestPNGChunkKeepsImageValid(t *testing.T) {
+	out, err := pngContainer{}.Embed(testPNG(t, 16, 16), testBlob(100, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("PNG with payload chunk doesn't decode: %v", err)
+	}
+	chunks, err := parsePNGChunks(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(chunks); n < 2 || chunks[n-2].typ != pngChunkType || chunks[n-1].typ != "IEND" {
+		t.Errorf("payload chunk isn't right before IEND")
+	}
+}
+
+func TestPNGLegacyTrailerMigration(t *testing.T) {
+	testTrailerMigration(t, testPNG(t, 16, 16), func(out []byte) bool {
+		chunks, err := parsePNGChunks(out)
+		if err != nil {
+			return false
+		}
+		for _, c := range chunks {
+			if c.typ == pngChunkType {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,173 @@
+package vault
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SignatureKey stores the JSON encoded Signature of the vault contents.
+const SignatureKey = ReservedPrefix + "signature"
+
+// signatureContext prefixes the signed message so vault signatures can't be
+// replayed as signatures over anything else.
+const signatureContext = "memevault-signature-v1\n"
+
+// VerifyMode selects how vault signatures are checked when opening a vault.
+type VerifyMode string
+
+const (
+	// VerifyWarn rejects invalid signatures and signers whose signing key
+	// changed, but only reports unsigned vaults and unknown or untrusted
+	// signers through Vault.Signer.
+	VerifyWarn VerifyMode = ""
+	// VerifyStrict also rejects unsigned vaults and unknown or untrusted
+	// signers.
+	VerifyStrict VerifyMode = "strict"
+	// VerifyOff skips signature checks.
+	VerifyOff VerifyMode = "off"
+)
+
+// ParseVerifyMode validates a --verify flag value.
+func ParseVerifyMode(s string) (VerifyMode, error) {
+	switch m := VerifyMode(s); m {
+	case VerifyWarn, VerifyStrict, VerifyOff:
+		return m, nil
+	case "warn":
+		return VerifyWarn, nil
+	}
+	return "", fmt.Errorf("unknown verify mode %q (expected warn, strict or off)", s)
+}
+
+var (
+	// ErrUnsigned is reported for vaults saved without a signature.
+	ErrUnsigned = errors.New("vault is not signed")
+	// ErrUnknownSigner is reported when the signer is not a recipient of the vault.
+	ErrUnknownSigner = errors.New("vault was signed by a key that is not a recipient")
+	// ErrBadSignature is returned when the signature doesn't match the contents.
+	ErrBadSignature = errors.New("vault signature is invalid (the vault may have been tampered with)")
+	// ErrUntrustedSigner is reported when the signer's signing key isn't
+	// pinned for the vault (see Options.KnownSigners).
+	ErrUntrustedSigner = errors.New("vault was signed by a recipient you don't trust yet")
+	// ErrSignerChanged is returned when the signer's signing key differs from
+	// the one pinned for them.
+	ErrSignerChanged = errors.New("vault was signed with a different signing key than the one pinned for the signer (the vault may have been tampered with)")
+)
+
+// Signature records who last saved the vault.
+type Signature struct {
+	// Signer is the public key (recipient) of the identity that saved the vault.
+	Signer string `json:"signer"`
+	// SigningKey is the base64 ed25519 public key derived from that identity.
+	SigningKey string `json:"signing_key"`
+	// Sig is the base64 ed25519 signature over the vault contents.
+	Sig string `json:"sig"`
+}
+
+// SigningKey derives the ed25519 signing key that accompanies a single
+// identity. The same identity always yields the same key. SSH keys are
+// derived from the decrypted private key rather than the key file, so a
+// passphrase protected key asks PassphrasePrompt for its passphrase.
+func SigningKey(identity string) (ed25519.PrivateKey, error) {
+	material := strings.TrimSpace(identity)
+	if isSSHIdentity(identity) {
+		secret, err := sshKeyMaterial([]byte(identity))
+		if err != nil {
+			return nil, err
+		}
+		material = "ssh:" + string(secret)
+	}
+	seed := sha256.Sum256([]byte("memevault-signing-v1:" + material))
+	return ed25519.NewKeyFromSeed(seed[:]), nil
+}
+
+// signingPublicKey returns the encoded public half of SigningKey(identity).
+func signingPublicKey(identity string) (string, error) {
+	key, err := SigningKey(identity)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)), nil
+}
+
+// signedMessage returns the bytes covered by the signature: the environment
+// name and every entry of the secrets map (recipients included) except the
+// signature itself. Binding the name stops environments being swapped.
+func signedMessage(secrets SecretsMap, env string) []byte {
+	unsigned := make(SecretsMap, len(secrets))
+	for k, v := range secrets {
+		if k != SignatureKey {
+			unsigned[k] = v
+		}
+	}
+	// json.Marshal sorts map keys, so the encoding is canonical
+	data, _ := json.Marshal(unsigned)
+	return append([]byte(signatureContext+env+"\n"), data...)
+}
+
+// sign signs the secrets of environment env with identity, storing the
+// signature under SignatureKey.
+func sign(secrets SecretsMap, identity, env string) error {
+	signer, err := IdentityRecipient(identity)
+	if err != nil {
+		return err
+	}
+	key, err := SigningKey(identity)
+	if err != nil {
+		return err
+	}
+	sig, _ := json.Marshal(Signature{
+		Signer:     signer,
+		SigningKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Sig:        base64.StdEncoding.EncodeToString(ed25519.Sign(key, signedMessage(secrets, env))),
+	})
+	secrets[SignatureKey] = string(sig)
+	return nil
+}
+
+// verify checks the signature stored in secrets against the recipient list.
+// identity (the reader's own keys) catches vaults claiming to be signed by
+// the reader with a different signing key. It returns the signing recipient.
+func verify(secrets SecretsMap, recipients []Recipient, identity, env string) (Recipient, error) {
+	val, ok := secrets[SignatureKey]
+	if !ok {
+		return Recipient{}, ErrUnsigned
+	}
+
+	var sig Signature
+	if err := json.Unmarshal([]byte(val), &sig); err != nil {
+		return Recipient{}, ErrBadSignature
+	}
+	pub, err := base64.StdEncoding.DecodeString(sig.SigningKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return Recipient{}, ErrBadSignature
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Sig)
+	if err != nil || !ed25519.Verify(pub, signedMessage(secrets, env), raw) {
+		return Recipient{}, ErrBadSignature
+	}
+
+	for _, id := range SplitIdentities(identity) {
+		if self, _ := IdentityRecipient(id); self != sig.Signer {
+			continue
+		}
+		own, err := signingPublicKey(id)
+		if err != nil {
+			return Recipient{}, err
+		}
+		if own != sig.SigningKey {
+			return Recipient{}, ErrBadSignature
+		}
+	}
+
+	for _, r := range recipients {
+		if r.PublicKey == sig.Signer && r.SigningKey == sig.SigningKey {
+			return r, nil
+		}
+	}
+	return Recipient{PublicKey: sig.Signer}, ErrUnknownSigner
+}
@@ -0,0 +1,116 @@
+package vault
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+)
+
+// isSSHKey reports whether s looks like an SSH public key
+// ("ssh-ed25519 AAAA...", as found in authorized_keys or on GitHub).
+func isSSHKey(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), "ssh-")
+}
+
+// isSSHIdentity reports whether s is a PEM encoded SSH private key.
+func isSSHIdentity(s string) bool {
+	return strings.Contains(s, "-----BEGIN ") && strings.Contains(s, " PRIVATE KEY-----")
+}
+
+// canonicalSSHKey returns an SSH public key without its comment, so the same
+// key always compares equal however it was pasted.
+func canonicalSSHKey(s string) (string, error) {
+	pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s))
+	if err != nil {
+		return "", err
+	}
+	if _, err := agessh.ParseRecipient(s); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pk))), nil
+}
+
+// parseSSHIdentity parses an SSH private key. Passphrase protected keys are
+// decrypted on use, asking PassphrasePrompt for the passphrase.
+func parseSSHIdentity(pemBytes []byte) (age.Identity, error) {
+	id, err := agessh.ParseIdentity(pemBytes)
+	if err == nil {
+		return id, nil
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return nil, err
+	}
+	if missing.PublicKey == nil {
+		return nil, errors.New("passphrase protected SSH key is missing its public key; convert it with ssh-keygen -p")
+	}
+
+	return agessh.NewEncryptedSSHIdentity(missing.PublicKey, pemBytes, sshPassphrase(missing.PublicKey))
+}
+
+// sshPassphrase returns a function asking PassphrasePrompt for the passphrase
+// of the SSH key with public key pk.
+func sshPassphrase(pk ssh.PublicKey) func() ([]byte, error) {
+	source := "SSH key " + ssh.FingerprintSHA256(pk)
+	return func() ([]byte, error) {
+		if PassphrasePrompt == nil {
+			return nil, fmt.Errorf("%s: %w", source, ErrPassphraseRequired)
+		}
+		pass, err := PassphrasePrompt(source)
+		return []byte(pass), err
+	}
+}
+
+// sshKeyMaterial returns the secret part of an SSH private key (the ed25519
+// seed or the RSA private exponent), decrypting passphrase protected keys.
+func sshKeyMaterial(pemBytes []byte) ([]byte, error) {
+	key, err := ssh.ParseRawPrivateKey(pemBytes)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if missing.PublicKey == nil {
+			return nil, errors.New("passphrase protected SSH key is missing its public key; convert it with ssh-keygen -p")
+		}
+		pass, err := sshPassphrase(missing.PublicKey)()
+		if err != nil {
+			return nil, err
+		}
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, pass)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH key: %v", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("invalid SSH key: %v", err)
+	}
+
+	switch k := key.(type) {
+	case *ed25519.PrivateKey:
+		return k.Seed(), nil
+	case *rsa.PrivateKey:
+		return k.D.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported SSH key type %T", key)
+}
+
+// sshIdentityRecipient returns the public key of an SSH private key without
+// decrypting it.
+func sshIdentityRecipient(pemBytes []byte) (string, error) {
+	var pk ssh.PublicKey
+	signer, err := ssh.ParsePrivateKey(pemBytes)
+	if err == nil {
+		pk = signer.PublicKey()
+	} else {
+		var missing *ssh.PassphraseMissingError
+		if !errors.As(err, &missing) || missing.PublicKey == nil {
+			return "", fmt.Errorf("invalid SSH key: %v", err)
+		}
+		pk = missing.PublicKey
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pk))), nil
+}
@@ -12,92 +12,72 @@ import (
 
 	"io"
 	"net/http"
-	"os"
 )
 
 // Magic bytes to identify our payload at the end of an image
 var MagicBytes = []byte("MEMEVAULT_MEME")
 
-// Embed appends the encrypted payload to the image at imagePath.
-// Format: [Original Image Bytes] [Payload] [Payload Length (8 bytes)] [Magic Bytes]
+// trailerSize is the fixed overhead appended after the payload blob.
+var trailerSize = 8 + len(MagicBytes)
+
+// Embed stores the encrypted payload in the vault file at imagePath, wrapped in
+// a current-version frame. Any payload already embedded is replaced.
 func Embed(imagePath string, payload []byte) error {
-	f, err := os.OpenFile(imagePath, os.O_APPEND|os.O_WRONLY, 0644)
+	return WriteFrame(imagePath, NewFrame(KindSecrets, FlagEncrypted, payload), Options{})
+}
+
+// Extract reads the encrypted payload from the vault file at imagePath.
+// Both framed and legacy (unframed) payloads are accepted.
+func Extract(imagePath string) ([]byte, error) {
+	frame, err := ReadFrame(imagePath, Options{})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
+	return frame.Payload, nil
+}
 
-	// Write payload
-	if _, err := f.Write(payload); err != nil {
-		return err
-	}
+// appendTrailer appends blob to data followed by its length and the magic bytes.
+// Format: [Original Bytes] [Payload] [Payload Length (8 bytes)] [Magic Bytes]
+func appendTrailer(data, blob []byte) []byte {
+	out := make([]byte, 0, len(data)+len(blob)+trailerSize)
+	out = append(out, data...)
+	out = append(out, blob...)
 
 	// Write length of payload (int64, little endian)
 	lengthBuf := make([]byte, 8)
-	binary.LittleEndian.PutUint64(lengthBuf, uint64(len(payload)))
-	if _, err := f.Write(lengthBuf); err != nil {
-		return err
-	}
-
-	// Write Magic Bytes
-	if _, err := f.Write(MagicBytes); err != nil {
-		return err
-	}
+	binary.LittleEndian.PutUint64(lengthBuf, uint64(len(blob)))
+	out = append(out, lengthBuf...)
 
-	return nil
+	return append(out, MagicBytes...)
 }
 
-// Extract reads the payload from the end of the image file.
-func Extract(imagePath string) ([]byte, error) {
-	f, err := os.Open(imagePath)
+// stripTrailer returns data without an appended payload, if it has one.
+func stripTrailer(data []byte) []byte {
+	start, _, err := locateTrailer(data)
 	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	stat, err := f.Stat()
-	if err != nil {
-		return nil, err
-	}
-
-	fileSize := stat.Size()
-	minSize := int64(len(MagicBytes) + 8)
-	if fileSize < minSize {
-		return nil, errors.New("file too small to contain memevault payload")
+		return data
 	}
+	return data[:start]
+}
 
-	// Read Magic Bytes
-	magicBuf := make([]byte, len(MagicBytes))
-	if _, err := f.ReadAt(magicBuf, fileSize-int64(len(MagicBytes))); err != nil {
-		return nil, err
+// locateTrailer finds the payload appended to data and returns its bounds.
+func locateTrailer(data []byte) (int, int, error) {
+	if len(data) < trailerSize {
+		return 0, 0, errors.New("file too small to contain memevault payload")
 	}
 
-	if !bytes.Equal(magicBuf, MagicBytes) {
-		// Fallback: maybe it's just a raw encrypted file?
-		// For now, strict steganography check.
-		return nil, errors.New("memevault magic bytes not found in image")
+	if !bytes.HasSuffix(data, MagicBytes) {
+		return 0, 0, errors.New("memevault magic bytes not found in image")
 	}
 
 	// Read Length
-	lengthBuf := make([]byte, 8)
-	lengthPos := fileSize - int64(len(MagicBytes)) - 8
-	if _, err := f.ReadAt(lengthBuf, lengthPos); err != nil {
-		return nil, err
-	}
-
-	payloadLen := int64(binary.LittleEndian.Uint64(lengthBuf))
-	if payloadLen <= 0 || payloadLen > fileSize-minSize {
-		return nil, errors.New("invalid payload length detected")
-	}
-
-	// Read Payload
-	payload := make([]byte, payloadLen)
-	payloadPos := lengthPos - payloadLen
-	if _, err := f.ReadAt(payload, payloadPos); err != nil {
-		return nil, err
+	lengthPos := len(data) - trailerSize
+	payloadLen := binary.LittleEndian.Uint64(data[lengthPos : lengthPos+8])
+	if payloadLen == 0 || payloadLen > uint64(lengthPos) {
+		return 0, 0, errors.New("invalid payload length detected")
 	}
 
-	return payload, nil
+	return lengthPos - int(payloadLen), lengthPos, nil
 }
 
 // MemeResponse struct for meme-api.com
@@ -0,0 +1,78 @@
+package vault
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrailer(t *testing.T) {
+	blob := EncodeFrame(NewFrame(KindSecrets, FlagEncrypted, []byte("ciphertext")))
+	data := appendTrailer([]byte("image"), blob)
+
+	start, end, err := locateTrailer(data)
+	if err != nil {
+		t.Fatalf("locateTrailer: %v", err)
+	}
+	if !bytes.Equal(data[start:end], blob) {
+		t.Errorf("locateTrailer found %x, want %x", data[start:end], blob)
+	}
+	if got := stripTrailer(data); string(got) != "image" {
+		t.Errorf("stripTrailer = %q, want %q", got, "image")
+	}
+	if got := stripTrailer([]byte("image")); string(got) != "image" {
+		t.Errorf("stripTrailer without a trailer = %q", got)
+	}
+
+	for name, bad := range map[string][]byte{
+		"too small":   MagicBytes,
+		"no magic":    append([]byte("image"), bytes.Repeat([]byte{0}, trailerSize)...),
+		"zero length": append(append([]byte("image"), make([]byte, 8)...), MagicBytes...),
+		"too long":    append(append([]byte("image"), 0xFF, 0, 0, 0, 0, 0, 0, 0), MagicBytes...),
+	} {
+		if _, _, err := locateTrailer(bad); err == nil {
+			t.Errorf("locateTrailer accepted %s", name)
+		}
+	}
+}
+
+func TestEmbedExtract(t *testing.T) {
+	legacy := []byte("age-encryption.org/v1\n...")
+
+	tests := []struct {
+		name     string
+		existing []byte // file contents before Embed, nil for no file
+		embed    []byte // payload to Embed, nil to only Extract
+		want     []byte
+	}{
+		{"new file", nil, []byte("ciphertext"), []byte("ciphertext")},
+		{"replaces payload", EncodeFrame(NewFrame(KindSecrets, FlagEncrypted, []byte("old"))), []byte("new"), []byte("new")},
+		{"trailer replaces payload", appendTrailer([]byte("GIF89a..."), legacy), []byte("new"), []byte("new")},
+		{"legacy unframed", legacy, nil, legacy},
+		{"legacy trailer", appendTrailer([]byte("GIF89a..."), legacy), nil, legacy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vault")
+			if tt.existing != nil {
+				if err := os.WriteFile(path, tt.existing, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.embed != nil {
+				if err := Embed(path, tt.embed); err != nil {
+					t.Fatalf("Embed: %v", err)
+				}
+			}
+
+			got, err := Extract(path)
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Extract = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// The signature and recipient list are inside the payload, so anyone who can
+// encrypt to the recipients can also forge them. Readers therefore pin the
+// signing key of each recipient they accept signatures from in a file of
+// their own (Options.KnownSigners), per vault and environment:
+//
+//   - the first time a reader opens an environment, its signer and the
+//     recipients it lists are pinned (trust on first use);
+//   - a vault signed by a pinned signer (or saved by the reader) also pins
+//     the recipients it lists that aren't pinned yet, so granting someone
+//     access vouches for them.
+//     Recipients that haven't signed yet are pinned without a key, and their
+//     first signature pins it;
+//   - a pinned signer whose signing key changed is rejected
+//     (ErrSignerChanged), and a signer that isn't pinned is reported as
+//     untrusted (ErrUntrustedSigner) until Vault.TrustSigner is called.
+//
+// The reader's own keys are always trusted.
+
+// SignerTrust says whether signatures by a recipient are accepted.
+type SignerTrust string
+
+const (
+	// TrustSelf is a recipient whose identity is loaded.
+	TrustSelf SignerTrust = "you"
+	// TrustPinned is a recipient whose recorded signing key is pinned.
+	TrustPinned SignerTrust = "trusted"
+	// TrustPending is a recipient pinned before they first signed the vault.
+	TrustPending SignerTrust = "pending"
+	// TrustChanged is a recipient whose recorded signing key differs from
+	// the pinned one.
+	TrustChanged SignerTrust = "changed"
+	// TrustUnknown is a recipient that isn't pinned.
+	TrustUnknown SignerTrust = "untrusted"
+)
+
+// DefaultKnownSignersFile returns the file the CLI pins signing keys in, or
+// "" if there is no home directory.
+func DefaultKnownSignersFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".memevault", "known_signers.json")
+}
+
+// knownSigners maps a vault environment (see signersKey) to the signing key
+// pinned for each recipient public key; "" means pending.
+type knownSigners map[string]map[string]string
+
+// signersKey names the environment env of the vault at path in a
+// knownSigners file.
+func signersKey(path, env string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return abs + "#" + env, nil
+}
+
+// loadKnownSigners reads a knownSigners file; a missing file is empty.
+func loadKnownSigners(path string) (knownSigners, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return knownSigners{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	known := knownSigners{}
+	if err := json.Unmarshal(data, &known); err != nil {
+		return nil, fmt.Errorf("invalid known signers file %s: %v", path, err)
+	}
+	return known, nil
+}
+
+// loadPins returns the signing keys pinned for the opened environment, or nil
+// if it has never been opened. Pinning is off without Options.KnownSigners.
+func (v *Vault) loadPins() (map[string]string, error) {
+	if v.Options.KnownSigners == "" {
+		return nil, nil
+	}
+	known, err := loadKnownSigners(v.Options.KnownSigners)
+	if err != nil {
+		return nil, err
+	}
+	key, err := signersKey(v.path, v.env)
+	if err != nil {
+		return nil, err
+	}
+	return known[key], nil
+}
+
+// savePins writes the pins of the opened environment back to
+// Options.KnownSigners, keeping those of other vaults.
+func (v *Vault) savePins() error {
+	path := v.Options.KnownSigners
+	known, err := loadKnownSigners(path)
+	if err != nil {
+		return err
+	}
+	key, err := signersKey(v.path, v.env)
+	if err != nil {
+		return err
+	}
+	known[key] = v.pins
+
+	data, _ := json.MarshalIndent(known, "", "  ")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, append(data, '\n'), 0600)
+}
+
+// SignerTrust reports whether signatures by recipient r are accepted when
+// the vault is opened.
+func (v *Vault) SignerTrust(r Recipient) SignerTrust {
+	if own, _ := IdentityRecipients(v.identity); slices.Contains(own, r.PublicKey) {
+		return TrustSelf
+	}
+	pin, ok := v.pins[r.PublicKey]
+	switch {
+	case !ok:
+		return TrustUnknown
+	case pin == "":
+		return TrustPending
+	case pin != r.SigningKey:
+		return TrustChanged
+	}
+	return TrustPinned
+}
+
+// checkTrust checks the verified signer against the pinned signing keys and,
+// if it is trusted, pins the recipients it lists (see the comment at the top
+// of this file).
+func (v *Vault) checkTrust() error {
+	if v.Options.KnownSigners == "" {
+		return nil
+	}
+	switch v.SignerTrust(v.signedBy) {
+	case TrustChanged:
+		return ErrSignerChanged
+	case TrustUnknown:
+		if v.pins != nil {
+			return ErrUntrustedSigner
+		}
+	}
+
+	v.vouch()
+	return nil
+}
+
+// vouch pins the recipients that aren't pinned yet, and the signing keys of
+// pending ones that have signed since. It is called for vaults signed by a
+// trusted signer, including the reader's own saves.
+//
+// The known signers file is only written when a pin was added. Failing to
+// write it doesn't stop the vault from being used (it may be opened in CI
+// with a read-only home directory); the error is kept for PinError instead.
+func (v *Vault) vouch() {
+	if v.Options.KnownSigners == "" {
+		return
+	}
+	v.pinErr = nil
+	changed := false
+	if v.pins == nil {
+		v.pins = map[string]string{}
+	}
+	for _, r := range v.recipients {
+		if pin, ok := v.pins[r.PublicKey]; !ok || (pin == "" && r.SigningKey != "") {
+			v.pins[r.PublicKey] = r.SigningKey
+			changed = true
+			if r.SigningKey != "" && v.SignerTrust(r) != TrustSelf {
+				v.newlyTrusted = append(v.newlyTrusted, r)
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := v.savePins(); err != nil {
+		v.pinErr = fmt.Errorf("failed to record trusted signers: %v", err)
+	}
+}
+
+// PinError returns why signing keys pinned while opening the vault, or by
+// the last Save, couldn't be written to Options.KnownSigners, or nil. They
+// are still trusted until the vault is closed.
+func (v *Vault) PinError() error {
+	return v.pinErr
+}
+
+// NewlyTrusted returns the recipients whose signing keys were pinned while
+// opening the vault.
+func (v *Vault) NewlyTrusted() []Recipient {
+	return v.newlyTrusted
+}
+
+// TrustSigner pins the signing key recorded for the recipient with the given
+// name or public key, replacing any pinned one. Only call it once the key has
+// been checked with its owner (see Recipient.SigningKey).
+func (v *Vault) TrustSigner(nameOrKey string) (Recipient, error) {
+	if v.Options.KnownSigners == "" {
+		return Recipient{}, fmt.Errorf("no known signers file to pin signing keys in")
+	}
+	for _, r := range v.recipients {
+		if r.Name != nameOrKey && r.PublicKey != nameOrKey {
+			continue
+		}
+		if r.SigningKey == "" {
+			return Recipient{}, fmt.Errorf("'%s' hasn't signed the vault yet", nameOrKey)
+		}
+		if v.pins == nil {
+			v.pins = map[string]string{}
+		}
+		v.pins[r.PublicKey] = r.SigningKey
+		return r, v.savePins()
+	}
+	return Recipient{}, fmt.Errorf("recipient '%s' not found", nameOrKey)
+}
@@ -0,0 +1,211 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testKey returns a new identity and its public key.
+func testKey(t *testing.T) (string, string) {
+	t.Helper()
+	identity, publicKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity, publicKey
+}
+
+// testOptions returns the options a reader with the given known signers file
+// opens vaults with. HOME is moved to a temporary directory so nothing falls
+// back to the real known signers file.
+func testOptions(t *testing.T, knownSigners string, verify VerifyMode) Options {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	opts := DefaultOptions()
+	opts.KnownSigners = knownSigners
+	opts.Verify = verify
+	return opts
+}
+
+// editPins rewrites the pins of every vault in a known signers file.
+func editPins(t *testing.T, path string, edit func(pins map[string]string)) {
+	t.Helper()
+	known, err := loadKnownSigners(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pins := range known {
+		edit(pins)
+	}
+	data, _ := json.Marshal(known)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyModes(t *testing.T) {
+	tests := []struct {
+		name       string
+		unsigned   bool
+		edit       func(alice string, pins map[string]string) // edits Bob's pins after his first open
+		verify     VerifyMode
+		wantOpen   error
+		wantSigner error
+	}{
+		{"signed", false, nil, VerifyWarn, nil, nil},
+		{"signed, strict", false, nil, VerifyStrict, nil, nil},
+		{"unsigned", true, nil, VerifyWarn, nil, ErrUnsigned},
+		{"unsigned, strict", true, nil, VerifyStrict, ErrUnsigned, nil},
+		{"unsigned, off", true, nil, VerifyOff, nil, nil},
+		{"untrusted signer", false, func(alice string, pins map[string]string) { delete(pins, alice) }, VerifyWarn, nil, ErrUntrustedSigner},
+		{"untrusted signer, strict", false, func(alice string, pins map[string]string) { delete(pins, alice) }, VerifyStrict, ErrUntrustedSigner, nil},
+		{"signer changed", false, func(alice string, pins map[string]string) { pins[alice] = "AAAA" }, VerifyWarn, ErrSignerChanged, nil},
+		{"signer changed, strict", false, func(alice string, pins map[string]string) { pins[alice] = "AAAA" }, VerifyStrict, ErrSignerChanged, nil},
+		{"signer changed, off", false, func(alice string, pins map[string]string) { pins[alice] = "AAAA" }, VerifyOff, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "prod.bin")
+			aliceID, alice := testKey(t)
+			bobID, bob := testKey(t)
+			bobKnown := filepath.Join(dir, "bob", "known_signers.json")
+
+			v := New(path, []Recipient{{Name: "alice", PublicKey: alice}, {Name: "bob", PublicKey: bob}})
+			v.Options = testOptions(t, filepath.Join(dir, "alice", "known_signers.json"), VerifyWarn)
+			if !tt.unsigned {
+				v.SignWith(aliceID)
+			}
+			v.Set("API_KEY", "secret")
+			if err := v.Save(); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			if tt.edit != nil {
+				// Bob trusts the vault on first use
+				if _, err := OpenWithOptions(path, bobID, testOptions(t, bobKnown, VerifyWarn)); err != nil {
+					t.Fatalf("first Open: %v", err)
+				}
+				editPins(t, bobKnown, func(pins map[string]string) { tt.edit(alice, pins) })
+			}
+
+			v, err := OpenWithOptions(path, bobID, testOptions(t, bobKnown, tt.verify))
+			if !errors.Is(err, tt.wantOpen) {
+				t.Fatalf("Open error = %v, want %v", err, tt.wantOpen)
+			}
+			if err != nil {
+				return
+			}
+			if val, _ := v.Get("API_KEY"); val != "secret" {
+				t.Errorf("Get = %q, want %q", val, "secret")
+			}
+			signer, err := v.Signer()
+			if !errors.Is(err, tt.wantSigner) {
+				t.Errorf("Signer error = %v, want %v", err, tt.wantSigner)
+			}
+			if err == nil && !tt.unsigned && tt.verify != VerifyOff && signer.PublicKey != alice {
+				t.Errorf("Signer = %s, want alice (%s)", signer.PublicKey, alice)
+			}
+		})
+	}
+}
+
+func TestTrustSigner(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prod.bin")
+	aliceID, alice := testKey(t)
+	bobID, bob := testKey(t)
+	bobKnown := filepath.Join(dir, "bob", "known_signers.json")
+
+	v := New(path, []Recipient{{Name: "alice", PublicKey: alice}, {Name: "bob", PublicKey: bob}})
+	v.Options = testOptions(t, filepath.Join(dir, "alice", "known_signers.json"), VerifyWarn)
+	v.SignWith(aliceID)
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenWithOptions(path, bobID, testOptions(t, bobKnown, VerifyWarn)); err != nil {
+		t.Fatal(err)
+	}
+	editPins(t, bobKnown, func(pins map[string]string) { pins[alice] = "AAAA" })
+
+	// After checking the key with Alice, Bob pins it again
+	opts := testOptions(t, bobKnown, VerifyOff)
+	v, err := OpenWithOptions(path, bobID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trust := v.SignerTrust(v.Recipients()[0]); trust != TrustChanged {
+		t.Errorf("SignerTrust = %s, want %s", trust, TrustChanged)
+	}
+	if _, err := v.TrustSigner("alice"); err != nil {
+		t.Fatalf("TrustSigner: %v", err)
+	}
+	if _, err := v.TrustSigner("carol"); err == nil {
+		t.Error("TrustSigner accepted an unknown recipient")
+	}
+
+	opts.Verify = VerifyStrict
+	if _, err := OpenWithOptions(path, bobID, opts); err != nil {
+		t.Errorf("Open after TrustSigner: %v", err)
+	}
+}
+
+func TestPinsWrittenOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prod.bin")
+	id, key := testKey(t)
+	known := filepath.Join(dir, "known_signers.json")
+
+	v := New(path, []Recipient{{Name: "me", PublicKey: key}})
+	v.Options = testOptions(t, known, VerifyWarn)
+	v.SignWith(id)
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(known, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenWithOptions(path, id, v.Options); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(known); err != nil || !info.ModTime().Equal(old) {
+		t.Error("opening a vault with nothing new to pin rewrote the known signers file")
+	}
+}
+
+func TestPinErrorIsAWarning(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prod.bin")
+	id, key := testKey(t)
+
+	// A dangling symlink in the path: there are no pins to read, and the
+	// directory for new ones can't be created (like a read-only home)
+	if err := os.Symlink(filepath.Join(dir, "missing", "home"), filepath.Join(dir, "home")); err != nil {
+		t.Skipf("can't create symlinks: %v", err)
+	}
+	opts := testOptions(t, filepath.Join(dir, "home", ".memevault", "known_signers.json"), VerifyWarn)
+
+	v := New(path, []Recipient{{Name: "me", PublicKey: key}})
+	v.Options = opts
+	v.SignWith(id)
+	if err := v.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if v.PinError() == nil {
+		t.Error("Save didn't report that the pins couldn't be written")
+	}
+
+	v, err := OpenWithOptions(path, id, opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if v.PinError() == nil {
+		t.Error("Open didn't report that the pins couldn't be written")
+	}
+}
@@ -0,0 +1,87 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// TypesKey stores the JSON encoded type of every secret that isn't text.
+const TypesKey = ReservedPrefix + "types"
+
+// ValueType says how a secret value is stored in the vault payload.
+type ValueType string
+
+const (
+	// TypeText values are stored as they are. They may span lines.
+	TypeText ValueType = "text"
+	// TypeBinary values are stored base64 encoded, since the payload is JSON
+	// and can only hold UTF-8.
+	TypeBinary ValueType = "binary"
+	// TypeTemplate values are text with ${KEY} references to other secrets
+	// (see Vault.SetTemplate). Only template values are ever expanded.
+	TypeTemplate ValueType = "template"
+)
+
+// TypeOf returns the type val is stored as: binary if it isn't valid UTF-8 or
+// holds NUL bytes (which no environment variable can), text otherwise.
+func TypeOf(val string) ValueType {
+	if !utf8.ValidString(val) || strings.IndexByte(val, 0) >= 0 {
+		return TypeBinary
+	}
+	return TypeText
+}
+
+// encodeTypes base64 encodes the binary values in secrets and records the
+// type of every binary and template value under TypesKey. Vaults holding only
+// plain text have no TypesKey.
+func encodeTypes(secrets SecretsMap, templates map[string]bool) {
+	types := map[string]ValueType{}
+	for _, k := range secrets.Keys() {
+		switch {
+		case TypeOf(secrets[k]) == TypeBinary:
+			types[k] = TypeBinary
+			secrets[k] = base64.StdEncoding.EncodeToString([]byte(secrets[k]))
+		case templates[k]:
+			types[k] = TypeTemplate
+		}
+	}
+	if len(types) > 0 {
+		data, _ := json.Marshal(types)
+		secrets[TypesKey] = string(data)
+	}
+}
+
+// decodeTypes undoes encodeTypes, removes TypesKey and returns the keys that
+// hold templates.
+func decodeTypes(secrets SecretsMap) (map[string]bool, error) {
+	templates := map[string]bool{}
+	val, ok := secrets[TypesKey]
+	if !ok {
+		return templates, nil
+	}
+	delete(secrets, TypesKey)
+
+	var types map[string]ValueType
+	if err := json.Unmarshal([]byte(val), &types); err != nil {
+		return nil, fmt.Errorf("invalid value types: %v", err)
+	}
+	for k, t := range types {
+		switch t {
+		case TypeText:
+		case TypeTemplate:
+			templates[k] = true
+		case TypeBinary:
+			data, err := base64.StdEncoding.DecodeString(secrets[k])
+			if err != nil {
+				return nil, fmt.Errorf("invalid binary value for '%s': %v", k, err)
+			}
+			secrets[k] = string(data)
+		default:
+			return nil, fmt.Errorf("secret '%s' has unknown type '%s'; upgrade memevault", k, t)
+		}
+	}
+	return templates, nil
+}
@@ -0,0 +1,522 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// SecretsMap is the decrypted vault payload. Keys starting with ReservedPrefix
+// hold memevault metadata rather than secrets.
+type SecretsMap map[string]string
+
+// Keys returns the secret names in sorted order, skipping metadata keys.
+func (s SecretsMap) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		if strings.HasPrefix(k, ReservedPrefix) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReservedPrefix marks metadata keys inside the secrets map.
+const ReservedPrefix = "_memevault_"
+
+// RecipientsKey stores the JSON encoded recipient list.
+const RecipientsKey = ReservedPrefix + "recipients"
+
+// Recipient is a named public key the vault is encrypted to: an age key
+// (age1...) or an SSH key (ssh-ed25519, ssh-rsa).
+type Recipient struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+	// SigningKey is the recipient's ed25519 signing key, recorded the first
+	// time they save the vault.
+	SigningKey string `json:"signing_key,omitempty"`
+}
+
+// Type returns the key type: "age", "ssh-ed25519" or "ssh-rsa".
+func (r Recipient) Type() string {
+	if isSSHKey(r.PublicKey) {
+		return strings.Fields(r.PublicKey)[0]
+	}
+	return "age"
+}
+
+// Options control how payloads are stored in and read from vault files.
+type Options struct {
+	// Stego selects the embedding mode for lossless images.
+	Stego StegoMode
+	// StegoKey seeds the pixel ordering used by StegoLSB. Readers must use
+	// the same key as the writer; nil uses a built-in default.
+	StegoKey []byte
+	// Padding is the plaintext size bucket policy used when saving.
+	Padding Padding
+	// Compress gzips the plaintext before padding when saving.
+	Compress bool
+	// Verify selects how the vault signature is checked when opening.
+	Verify VerifyMode
+	// KnownSigners is the file the reader pins signers' signing keys in (see
+	// SignerTrust); empty turns pinning off, so any recipient may sign.
+	KnownSigners string
+	// Env is the environment to open; empty means DefaultEnv.
+	Env string
+}
+
+// DefaultOptions returns the options the CLI uses unless told otherwise.
+func DefaultOptions() Options {
+	return Options{Padding: PadPowerOfTwo, Compress: true, KnownSigners: DefaultKnownSignersFile()}
+}
+
+var validKey = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ValidKey reports whether key is usable as an environment variable name.
+func ValidKey(key string) bool {
+	return validKey.MatchString(key)
+}
+
+// Vault is an opened, decrypted vault file.
+type Vault struct {
+	// Options are used when the vault is saved.
+	Options Options
+
+	path      string
+	env       string
+	parent    string
+	identity  string
+	matched   string
+	signer    string
+	signedBy  Recipient
+	verifyErr error
+	// pins are the signing keys pinned for this environment, nil if it was
+	// never opened; newlyTrusted were pinned while opening it, and pinErr is
+	// why they couldn't be recorded.
+	pins         map[string]string
+	newlyTrusted []Recipient
+	pinErr       error
+	secrets      SecretsMap
+	templates    map[string]bool
+	recipients   []Recipient
+	// others holds the encoded frames of the environments that weren't
+	// opened; they are written back untouched.
+	others map[string][]byte
+}
+
+// New returns an empty vault that will be written to path on Save.
+func New(path string, recipients []Recipient) *Vault {
+	return &Vault{
+		Options:    DefaultOptions(),
+		path:       path,
+		env:        DefaultEnv,
+		secrets:    SecretsMap{},
+		templates:  map[string]bool{},
+		recipients: recipients,
+		others:     map[string][]byte{},
+	}
+}
+
+// Open reads and decrypts the vault at path with the given identity (the
+// contents of a key file, see LoadIdentityFromFile). If identity holds
+// several keys, any of them may decrypt the vault.
+func Open(path, identity string) (*Vault, error) {
+	return OpenWithOptions(path, identity, DefaultOptions())
+}
+
+// OpenWithOptions is like Open, but uses opts to read and later save the
+// vault, and opens the environment named by opts.Env.
+func OpenWithOptions(path, identity string, opts Options) (*Vault, error) {
+	frame, err := ReadFrame(path, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault file: %v", err)
+	}
+
+	env := opts.Env
+	if env == "" {
+		env = DefaultEnv
+	}
+	envs, err := decodeEnvs(frame)
+	if err != nil {
+		return nil, err
+	}
+	data, err := envData(envs, env)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := decodeVault(path, data, env, identity, opts)
+	if err != nil {
+		if len(envs) > 1 {
+			return nil, fmt.Errorf("environment '%s': %w", env, err)
+		}
+		return nil, err
+	}
+	delete(envs, env)
+	v.others = envs
+	return v, nil
+}
+
+// decodeVault decrypts the encoded frame of a single environment.
+func decodeVault(path string, data []byte, env, identity string, opts Options) (*Vault, error) {
+	frame, err := DecodeFrame(data)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, matched, err := decodeSecrets(frame, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Vault{
+		Options:    opts,
+		path:       path,
+		env:        env,
+		parent:     secrets[ParentKey],
+		identity:   identity,
+		matched:    matched,
+		signer:     matched,
+		secrets:    secrets,
+		recipients: parseRecipients(secrets[RecipientsKey]),
+	}
+
+	if v.pins, err = v.loadPins(); err != nil {
+		return nil, err
+	}
+	if opts.Verify != VerifyOff {
+		v.signedBy, v.verifyErr = verify(secrets, v.recipients, identity, env)
+		if v.verifyErr == nil {
+			v.verifyErr = v.checkTrust()
+		}
+		switch v.verifyErr {
+		case nil, ErrUnsigned, ErrUnknownSigner, ErrUntrustedSigner:
+			if v.verifyErr != nil && opts.Verify == VerifyStrict {
+				return nil, v.verifyErr
+			}
+		default:
+			return nil, v.verifyErr
+		}
+	}
+
+	if v.templates, err = decodeTypes(secrets); err != nil {
+		return nil, err
+	}
+	delete(secrets, RecipientsKey)
+	delete(secrets, SignatureKey)
+	delete(secrets, ParentKey)
+	return v, nil
+}
+
+// Path returns the vault file path.
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// OpenedWith returns the public key of the identity that decrypted the vault,
+// or "" for a vault created with New.
+func (v *Vault) OpenedWith() string {
+	if v.matched == "" {
+		return ""
+	}
+	key, _ := IdentityRecipient(v.matched)
+	return key
+}
+
+// Signer returns the recipient that signed the vault when it was last saved.
+// The error is ErrUnsigned, ErrUnknownSigner or ErrUntrustedSigner if the
+// signature couldn't be attributed to a trusted recipient (only possible with
+// VerifyWarn), and nil when verification is off.
+func (v *Vault) Signer() (Recipient, error) {
+	return v.signedBy, v.verifyErr
+}
+
+// SignWith sets the identity that signs the vault on Save. Opened vaults are
+// signed with the identity that decrypted them; vaults created with New are
+// saved unsigned unless SignWith is called.
+func (v *Vault) SignWith(identity string) {
+	v.signer = identity
+}
+
+// Get returns the value of a secret.
+func (v *Vault) Get(key string) (string, bool) {
+	val, ok := v.secrets[key]
+	return val, ok
+}
+
+// Set stores a secret as a literal value, so it is never expanded. Keys must
+// be valid environment variable names that don't start with ReservedPrefix.
+func (v *Vault) Set(key, value string) error {
+	if !ValidKey(key) {
+		return fmt.Errorf("key '%s' contains invalid characters; keys must match [a-zA-Z_][a-zA-Z0-9_]*", key)
+	}
+	if strings.HasPrefix(key, ReservedPrefix) {
+		return fmt.Errorf("key prefix %s is reserved", ReservedPrefix)
+	}
+	v.secrets[key] = value
+	delete(v.templates, key)
+	return nil
+}
+
+// SetTemplate stores a secret whose ${KEY} references are expanded when it
+// is read (see Expanded). The template must be well formed text; whether the
+// keys it references exist is only checked on expansion.
+func (v *Vault) SetTemplate(key, value string) error {
+	if TypeOf(value) == TypeBinary {
+		return fmt.Errorf("binary values can't be templates")
+	}
+	if err := checkTemplate(key, value); err != nil {
+		return err
+	}
+	if err := v.Set(key, value); err != nil {
+		return err
+	}
+	v.templates[key] = true
+	return nil
+}
+
+// IsTemplate reports whether the secret was stored with SetTemplate.
+func (v *Vault) IsTemplate(key string) bool {
+	return v.templates[key]
+}
+
+// Delete removes a secret, reporting whether it existed.
+func (v *Vault) Delete(key string) bool {
+	if _, ok := v.secrets[key]; !ok {
+		return false
+	}
+	delete(v.secrets, key)
+	delete(v.templates, key)
+	return true
+}
+
+// Keys returns the names of the secrets set in the opened environment (not
+// inherited ones, see Resolved) in sorted order.
+func (v *Vault) Keys() []string {
+	return v.secrets.Keys()
+}
+
+// Recipients returns a copy of the recipient list.
+func (v *Vault) Recipients() []Recipient {
+	return append([]Recipient(nil), v.recipients...)
+}
+
+// SetRecipients replaces the recipient list.
+func (v *Vault) SetRecipients(recipients []Recipient) {
+	v.recipients = append([]Recipient(nil), recipients...)
+}
+
+// Grant adds a recipient. The vault is re-encrypted for them on Save.
+// SSH keys are stored without their comment.
+func (v *Vault) Grant(name, publicKey string) error {
+	if isSSHKey(publicKey) {
+		key, err := canonicalSSHKey(publicKey)
+		if err != nil {
+			return fmt.Errorf("invalid SSH public key %q: %v", publicKey, err)
+		}
+		publicKey = key
+	} else if _, err := age.ParseX25519Recipient(publicKey); err != nil {
+		return fmt.Errorf("invalid public key %q: %v", publicKey, err)
+	}
+	for _, r := range v.recipients {
+		if r.Name == name {
+			return fmt.Errorf("a recipient named '%s' already exists", name)
+		}
+		if r.PublicKey == publicKey {
+			return fmt.Errorf("key %s already has access (as '%s')", publicKey, r.Name)
+		}
+	}
+	v.recipients = append(v.recipients, Recipient{Name: name, PublicKey: publicKey})
+	return nil
+}
+
+// ErrRevokeSelf is returned when a revocation would leave none of the
+// identities the vault was opened with able to decrypt it.
+var ErrRevokeSelf = errors.New("you cannot remove yourself")
+
+// Revoke removes the recipient matching target by name or public key,
+// reporting whether one was found. The vault is re-encrypted on Save.
+func (v *Vault) Revoke(target string) (bool, error) {
+	self, _ := IdentityRecipients(v.identity)
+
+	var kept []Recipient
+	removed, selfKept, selfRemoved := false, false, false
+	for _, r := range v.recipients {
+		isSelf := slices.Contains(self, r.PublicKey)
+		if r.Name == target || r.PublicKey == target {
+			removed = true
+			selfRemoved = selfRemoved || isSelf
+			continue
+		}
+		selfKept = selfKept || isSelf
+		kept = append(kept, r)
+	}
+	if selfRemoved && !selfKept {
+		return false, ErrRevokeSelf
+	}
+
+	v.recipients = kept
+	return removed, nil
+}
+
+// Save signs the vault, encrypts it to its recipients and writes it back to
+// its file. The signer's signing key is recorded in their recipient entry,
+// and the recipients are pinned as trusted (see PinError). Other
+// environments are written back as they were read.
+func (v *Vault) Save() error {
+	frame, err := v.encode()
+	if err != nil {
+		return err
+	}
+
+	envs := make(map[string][]byte, len(v.others)+1)
+	for name, data := range v.others {
+		envs[name] = data
+	}
+	envs[v.env] = EncodeFrame(frame)
+	if frame, err = encodeEnvs(envs); err != nil {
+		return err
+	}
+
+	// WriteFrame keeps the existing container (image) and replaces its payload
+	if err := WriteFrame(v.path, frame, v.Options); err != nil {
+		return err
+	}
+	// A vault we signed vouches for its recipients
+	if v.signer != "" {
+		v.vouch()
+	}
+	return nil
+}
+
+// encode signs and encrypts the opened environment into a secrets frame.
+func (v *Vault) encode() (*Frame, error) {
+	if v.signer != "" {
+		self, err := IdentityRecipient(v.signer)
+		if err != nil {
+			return nil, err
+		}
+		for i, r := range v.recipients {
+			if r.PublicKey == self {
+				if v.recipients[i].SigningKey, err = signingPublicKey(v.signer); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var keys []string
+	for _, r := range v.recipients {
+		keys = append(keys, r.PublicKey)
+	}
+
+	secrets := make(SecretsMap, len(v.secrets)+4)
+	for k, val := range v.secrets {
+		secrets[k] = val
+	}
+	encodeTypes(secrets, v.templates)
+	recipients, _ := json.Marshal(v.recipients)
+	secrets[RecipientsKey] = string(recipients)
+	if v.parent != "" {
+		secrets[ParentKey] = v.parent
+	}
+	if v.signer != "" {
+		if err := sign(secrets, v.signer, v.env); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := FlagEncrypted
+	if v.Options.Compress {
+		var ok bool
+		if data, ok = Compress(data); ok {
+			flags |= FlagCompressed
+		}
+	}
+	if v.Options.Padding != PadNone {
+		data = Pad(data, v.Options.Padding)
+		flags |= FlagPadded
+	}
+
+	encrypted, err := Encrypt(data, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFrame(KindSecrets, flags, encrypted), nil
+}
+
+// decodeSecrets decrypts a secrets frame and undoes its plaintext transforms.
+// It also returns the identity that decrypted it.
+func decodeSecrets(frame *Frame, identity string) (SecretsMap, string, error) {
+	if frame.Kind != KindSecrets || !frame.Flags.Has(FlagEncrypted) {
+		return nil, "", fmt.Errorf("unsupported vault payload (kind %d, flags 0x%04x)", frame.Kind, uint16(frame.Flags))
+	}
+
+	decrypted, matched, err := DecryptMatch(frame.Payload, identity)
+	if err != nil {
+		return nil, "", fmt.Errorf("decryption failed: %w", err)
+	}
+
+	if frame.Flags.Has(FlagPadded) {
+		if decrypted, err = Unpad(decrypted); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if frame.Flags.Has(FlagCompressed) {
+		if decrypted, err = Decompress(decrypted); err != nil {
+			return nil, "", fmt.Errorf("failed to decompress payload: %v", err)
+		}
+	}
+
+	var secrets SecretsMap
+	if err := json.Unmarshal(decrypted, &secrets); err != nil {
+		return nil, "", fmt.Errorf("invalid json payload: %v", err)
+	}
+	if secrets == nil {
+		secrets = SecretsMap{}
+	}
+
+	return secrets, matched, nil
+}
+
+// parseRecipients decodes the recipients metadata, migrating the legacy
+// format (a plain list of public keys) to named recipients.
+func parseRecipients(val string) []Recipient {
+	if val == "" {
+		return []Recipient{}
+	}
+
+	// Try parsing as new format
+	var recipients []Recipient
+	if err := json.Unmarshal([]byte(val), &recipients); err == nil {
+		return recipients
+	}
+
+	// Fallback: Try parsing as old format ([]string)
+	var keys []string
+	if err := json.Unmarshal([]byte(val), &keys); err == nil {
+		// Migrate
+		migrated := make([]Recipient, len(keys))
+		for i, k := range keys {
+			migrated[i] = Recipient{Name: fmt.Sprintf("legacy-%s", k[:min(8, len(k))]), PublicKey: k}
+		}
+		return migrated
+	}
+
+	return []Recipient{}
+}
@@ -0,0 +1,304 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testNewVault returns a new signed vault at path in dir, encrypted to a new
+// identity, and that identity. Known signers are kept in dir.
+func testNewVault(t *testing.T, dir, name string) (*Vault, string) {
+	t.Helper()
+	identity, publicKey := testKey(t)
+	v := New(filepath.Join(dir, name), []Recipient{{Name: "me", PublicKey: publicKey}})
+	v.Options = testOptions(t, filepath.Join(dir, "known_signers.json"), VerifyStrict)
+	v.SignWith(identity)
+	return v, identity
+}
+
+// testReopen saves v and opens it again with identity, in environment env.
+func testReopen(t *testing.T, v *Vault, identity, env string) *Vault {
+	t.Helper()
+	if err := v.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	opts := v.Options
+	opts.Env = env
+	reopened, err := OpenWithOptions(v.Path(), identity, opts)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return reopened
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	binary := string([]byte{0x00, 0xFF, 0xFE, 0x80, '\n', 0x01})
+	tests := []struct {
+		name    string
+		file    string
+		opts    func(*Options)
+		secrets map[string]string
+	}{
+		{"raw file", "prod.bin", nil, map[string]string{"API_KEY": "12345", "EMPTY": ""}},
+		{"jpeg", "secrets.jpg", nil, map[string]string{"API_KEY": "12345"}},
+		{"png in lsb mode", "secrets.png", func(o *Options) { o.Stego = StegoLSB }, map[string]string{"API_KEY": "12345"}},
+		{"uncompressed and unpadded", "prod.bin", func(o *Options) { o.Compress = false; o.Padding = PadNone }, map[string]string{"API_KEY": "12345"}},
+		{"multiline", "prod.bin", nil, map[string]string{"CERT": "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"}},
+		{"binary", "prod.bin", nil, map[string]string{"KEYSTORE": binary, "TEXT": "plain"}},
+		{"value that looks like an encoded binary", "prod.bin", nil, map[string]string{"B64": "base64:AAEC"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var image []byte
+			switch filepath.Ext(tt.file) {
+			case ".jpg":
+				image = testJPEG(t, 16, 16)
+			case ".png":
+				image = testPNG(t, 128, 128)
+			}
+			if image != nil {
+				if err := os.WriteFile(filepath.Join(dir, tt.file), image, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			v, identity := testNewVault(t, dir, tt.file)
+			if tt.opts != nil {
+				tt.opts(&v.Options)
+			}
+			for k, val := range tt.secrets {
+				if err := v.Set(k, val); err != nil {
+					t.Fatalf("Set(%s): %v", k, err)
+				}
+			}
+
+			v = testReopen(t, v, identity, "")
+			keys := make([]string, 0, len(tt.secrets))
+			for k, want := range tt.secrets {
+				keys = append(keys, k)
+				if got, ok := v.Get(k); !ok || got != want {
+					t.Errorf("Get(%s) = %q, %v; want %q", k, got, ok, want)
+				}
+			}
+			slices.Sort(keys)
+			if !slices.Equal(v.Keys(), keys) {
+				t.Errorf("Keys = %v, want %v", v.Keys(), keys)
+			}
+			if signer, err := v.Signer(); err != nil || signer.Name != "me" {
+				t.Errorf("Signer = %+v, %v; want me", signer, err)
+			}
+		})
+	}
+}
+
+func TestVaultSetErrors(t *testing.T) {
+	v := New(filepath.Join(t.TempDir(), "prod.bin"), nil)
+	for key, want := range map[string]string{
+		"bad-key":           "contains invalid characters",
+		"1KEY":              "contains invalid characters",
+		"":                  "contains invalid characters",
+		"_memevault_parent": "key prefix _memevault_ is reserved",
+	} {
+		if err := v.Set(key, "x"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Set(%q) = %v, want an error containing %q", key, err, want)
+		}
+	}
+}
+
+func TestVaultDeleteAndTemplates(t *testing.T) {
+	v, identity := testNewVault(t, t.TempDir(), "prod.bin")
+	v.Set("USER", "admin")
+	v.Set("GONE", "x")
+	if err := v.SetTemplate("URL", "https://${USER}@host"); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Delete("GONE") || v.Delete("GONE") {
+		t.Error("Delete should report whether the key existed")
+	}
+
+	v = testReopen(t, v, identity, "")
+	if _, ok := v.Get("GONE"); ok {
+		t.Error("deleted key is back after reopening")
+	}
+	if !v.IsTemplate("URL") || v.IsTemplate("USER") {
+		t.Error("template flags weren't kept")
+	}
+	if raw, _ := v.Get("URL"); raw != "https://${USER}@host" {
+		t.Errorf("Get(URL) = %q, want the unexpanded template", raw)
+	}
+	expanded, err := v.Expanded("URL")
+	if err != nil || expanded["URL"] != "https://admin@host" {
+		t.Errorf("Expanded(URL) = %q, %v", expanded["URL"], err)
+	}
+
+	// Setting a literal value drops the template flag
+	v.Set("URL", "${USER}")
+	v = testReopen(t, v, identity, "")
+	if expanded, _ := v.Expanded(); v.IsTemplate("URL") || expanded["URL"] != "${USER}" {
+		t.Errorf("URL = %q (template: %v), want the literal value", expanded["URL"], v.IsTemplate("URL"))
+	}
+}
+
+func TestVaultEnvironments(t *testing.T) {
+	v, identity := testNewVault(t, t.TempDir(), "prod.bin")
+	v.Set("HOST", "db.internal")
+	v.Set("PASSWORD", "dev")
+	v.SetTemplate("URL", "postgres://${HOST}/${PASSWORD}")
+
+	// Parents are decrypted with the identity the vault was opened with
+	v = testReopen(t, v, identity, "")
+	if err := v.CreateEnv("prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.CreateEnv("prod"); err == nil {
+		t.Error("CreateEnv created an environment twice")
+	}
+	if err := v.CreateEnv("bad name"); err == nil {
+		t.Error("CreateEnv accepted an invalid name")
+	}
+	if len(v.Keys()) != 0 || v.Parent() != "" {
+		t.Errorf("new environment has keys %v and parent %q", v.Keys(), v.Parent())
+	}
+	if err := v.SetParent("default"); err != nil {
+		t.Fatal(err)
+	}
+	v.Set("PASSWORD", "prod")
+
+	prod := testReopen(t, v, identity, "prod")
+	if !slices.Equal(prod.Envs(), []string{"default", "prod"}) {
+		t.Errorf("Envs = %v", prod.Envs())
+	}
+	if prod.Parent() != "default" || !slices.Equal(prod.Keys(), []string{"PASSWORD"}) {
+		t.Errorf("prod has parent %q and keys %v", prod.Parent(), prod.Keys())
+	}
+	expanded, err := prod.Expanded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SecretsMap{"HOST": "db.internal", "PASSWORD": "prod", "URL": "postgres://db.internal/prod"}
+	if len(expanded) != len(want) {
+		t.Errorf("Expanded = %q, want %q", expanded, want)
+	}
+	for k, val := range want {
+		if expanded[k] != val {
+			t.Errorf("%s = %q, want %q", k, expanded[k], val)
+		}
+	}
+
+	layers, err := prod.Layers()
+	if err != nil || len(layers) != 2 || layers[0].Env != "prod" || layers[1].Env != "default" {
+		t.Errorf("Layers = %+v, %v", layers, err)
+	}
+
+	// The parent environment is unchanged
+	def := testReopen(t, prod, identity, "default")
+	if val, _ := def.Get("PASSWORD"); val != "dev" || def.Parent() != "" {
+		t.Errorf("default has PASSWORD %q and parent %q", val, def.Parent())
+	}
+
+	if err := def.SetParent("prod"); err == nil || !strings.Contains(err.Error(), "loops") {
+		t.Errorf("SetParent making a loop = %v", err)
+	}
+	if err := def.SetParent("staging"); err == nil {
+		t.Error("SetParent accepted an environment that doesn't exist")
+	}
+
+	opts := def.Options
+	opts.Env = "staging"
+	if _, err := OpenWithOptions(def.Path(), identity, opts); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Open of a missing environment = %v", err)
+	}
+}
+
+func TestCreateEnvFromChild(t *testing.T) {
+	v, identity := testNewVault(t, t.TempDir(), "prod.bin")
+	v.Set("SHARED", "base")
+	v = testReopen(t, v, identity, "")
+	v.CreateEnv("dev")
+	if err := v.SetParent("default"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An environment created while in dev doesn't inherit dev's parent
+	dev := testReopen(t, v, identity, "dev")
+	if err := dev.CreateEnv("other"); err != nil {
+		t.Fatal(err)
+	}
+	other := testReopen(t, dev, identity, "other")
+	if other.Parent() != "" {
+		t.Errorf("other inherits from %q", other.Parent())
+	}
+	if resolved, _ := other.Resolved(); len(resolved) != 0 {
+		t.Errorf("other resolves %q", resolved)
+	}
+}
+
+func TestVaultAccess(t *testing.T) {
+	dir := t.TempDir()
+	v, identity := testNewVault(t, dir, "prod.bin")
+	bobID, bob := testKey(t)
+
+	if err := v.Grant("bob", bob); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if err := v.Grant("bob", bob); err == nil {
+		t.Error("Grant accepted a duplicate recipient")
+	}
+	if err := v.Grant("eve", "age1notakey"); err == nil {
+		t.Error("Grant accepted an invalid public key")
+	}
+	v.Set("API_KEY", "secret")
+	v = testReopen(t, v, identity, "")
+
+	// Bob reads the vault with his own known signers
+	opts := testOptions(t, filepath.Join(dir, "bob.json"), VerifyStrict)
+	if b, err := OpenWithOptions(v.Path(), bobID, opts); err != nil {
+		t.Fatalf("Open as bob: %v", err)
+	} else if val, _ := b.Get("API_KEY"); val != "secret" {
+		t.Errorf("bob reads %q", val)
+	}
+
+	if _, err := v.Revoke("me"); !errors.Is(err, ErrRevokeSelf) {
+		t.Errorf("Revoke of the only own key = %v, want %v", err, ErrRevokeSelf)
+	}
+	if removed, err := v.Revoke("bob"); !removed || err != nil {
+		t.Fatalf("Revoke(bob) = %v, %v", removed, err)
+	}
+	v = testReopen(t, v, identity, "")
+	if _, err := OpenWithOptions(v.Path(), bobID, opts); err == nil {
+		t.Error("bob can still open the vault after being revoked")
+	}
+}
+
+func TestVaultOpenErrors(t *testing.T) {
+	dir := t.TempDir()
+	v, _ := testNewVault(t, dir, "prod.bin")
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := testKey(t)
+	if _, err := OpenWithOptions(v.Path(), other, v.Options); err == nil || !strings.Contains(err.Error(), "decryption failed") {
+		t.Errorf("Open with a key that has no access = %v", err)
+	}
+	if _, err := OpenWithOptions(filepath.Join(dir, "missing.bin"), other, v.Options); err == nil {
+		t.Error("Open of a missing file succeeded")
+	}
+
+	// Corrupting the ciphertext is caught by the frame checksum
+	data, err := os.ReadFile(v.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(v.Path(), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenWithOptions(v.Path(), other, v.Options); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Open of a corrupted vault = %v", err)
+	}
+}